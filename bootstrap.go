@@ -0,0 +1,438 @@
+package letsgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gomodule/redigo/redis"
+	"github.com/time2k/letsgo-ng/config"
+	"gopkg.in/yaml.v3"
+)
+
+// bootStep 声明式启动中的一个初始化步骤
+type bootStep struct {
+	name     string
+	enabled  bool
+	requires []string //硬依赖，依赖未启用时报错
+	after    []string //软依赖，仅在依赖启用时保证先后顺序
+	run      func(L *Letsgo, cfg *config.BootConfig) error
+}
+
+// LoadBootConfig 读取配置文件，根据扩展名选择yaml/toml/json解析
+func LoadBootConfig(path string) (*config.BootConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Bootstrap read config file '%s': %w", path, err)
+	}
+
+	cfg := &config.BootConfig{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, cfg)
+	case ".toml":
+		err = toml.Unmarshal(content, cfg)
+	case ".json":
+		err = json.Unmarshal(content, cfg)
+	default:
+		return nil, fmt.Errorf("[error]Bootstrap unsupported config file type '%s', use yaml, toml or json", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[error]Bootstrap parse config file '%s': %w", path, err)
+	}
+	return cfg, nil
+}
+
+// InitFromFile 读取配置文件并按依赖顺序初始化框架，返回初始化完成的Letsgo
+// 配置文件支持yaml/toml/json，db段落沿用config.DBconfigStruct，其中DBconnMaxLifeTime在json中以纳秒表示
+func InitFromFile(path string) (*Letsgo, error) {
+	cfg, err := LoadBootConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return InitFromConfig(cfg)
+}
+
+// InitFromConfig 按依赖顺序初始化框架，任何一步失败都会关闭已初始化的资源并返回错误
+// 返回的Letsgo为独立实例，仅在Default为nil时同时设置为Default；启动期间收到SIGTERM/SIGINT时返回错误，由调用方退出
+func InitFromConfig(cfg *config.BootConfig) (*Letsgo, error) {
+	steps, err := sortBootSteps(bootSteps(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	L := New()
+	L.Init()
+	for dependency, retry := range cfg.Retry {
+		L.SetStartupRetry(dependency, RetryPolicy{
+			MaxAttempts:    retry.MaxAttempts,
+			InitialBackoff: retry.InitialBackoff.Std(),
+			MaxBackoff:     retry.MaxBackoff.Std(),
+			Multiplier:     retry.Multiplier,
+		})
+	}
+
+	if srv := cfg.Server; srv != nil {
+		L.ServerOptions = ServerOptions{
+			ServiceName: srv.ServiceName,
+			BodyLimit:   srv.BodyLimit,
+			Timeout:     srv.Timeout.Std(),
+			AccessLog:   srv.AccessLog,
+			TLSCertFile: srv.TLSCertFile,
+			TLSKeyFile:  srv.TLSKeyFile,
+		}
+	}
+
+	//启动期间收到SIGTERM/SIGINT时中断重试等待，已初始化的资源随后关闭
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	L.StartupContext = ctx
+	defer func() { L.StartupContext = nil }()
+
+	//在初始化步骤之前设置Default，InitMemConfig等按L == Default使用全局配置
+	promoted := Default == nil
+	if promoted {
+		Default = L
+	}
+	for _, step := range steps {
+		if err := runBootStep(L, cfg, step); err != nil {
+			L.Close()
+			if promoted {
+				Default = nil
+			}
+			return nil, err
+		}
+	}
+	return L, nil
+}
+
+// runBootStep 执行单个初始化步骤
+func runBootStep(L *Letsgo, cfg *config.BootConfig, step bootStep) error {
+	if err := step.run(L, cfg); err != nil {
+		return fmt.Errorf("[error]Bootstrap init %s: %w", step.name, err)
+	}
+	return nil
+}
+
+// bootSteps 根据配置生成全部初始化步骤
+func bootSteps(cfg *config.BootConfig) []bootStep {
+	needDiscovery := false
+	for _, rpcconfig := range cfg.RPC {
+		if rpcconfig.Address == "" {
+			needDiscovery = true
+		}
+	}
+	rpcrequires := []string{}
+	if needDiscovery {
+		rpcrequires = append(rpcrequires, "microservice")
+	}
+
+	return []bootStep{
+		{
+			name:    "log",
+			enabled: cfg.Log != nil,
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.LogOptions = LogOptions{Level: cfg.Log.Level, Format: cfg.Log.Format, AddSource: cfg.Log.AddSource}
+				if r := cfg.Log.Rotate; r != nil {
+					L.LogOptions.Rotate = RotateOptions{MaxSizeMB: r.MaxSizeMB, Interval: r.Interval.Std(), MaxBackups: r.MaxBackups, MaxAge: r.MaxAge.Std(), Compress: r.Compress}
+				}
+				if cfg.Log.File == "" {
+					return L.InitSlog(os.Stderr)
+				}
+				return L.InitLogE(cfg.Log.File)
+			},
+		},
+		{
+			name:    "mem_config",
+			enabled: cfg.MemConfig,
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.InitMemConfig()
+				return nil
+			},
+		},
+		{
+			name:    "context_set",
+			enabled: cfg.ContextSet,
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.InitContextSet()
+				return nil
+			},
+		},
+		{
+			name:    "schedule",
+			enabled: cfg.Schedule,
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.InitSchedule()
+				return nil
+			},
+		},
+		{
+			name:    "cache",
+			enabled: cfg.Cache != nil,
+			after:   []string{"log"},
+			run:     bootCache,
+		},
+		{
+			name:     "cache_lock",
+			enabled:  cfg.CacheLock,
+			requires: []string{"cache"},
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				if cache := L.redisCache(); cache == nil || cache.UseRedisOrMemcached != 2 {
+					return fmt.Errorf("cache lock needs redis cache")
+				}
+				return L.InitCacheLockE()
+			},
+		},
+		{
+			name:    "db",
+			enabled: len(cfg.DB) > 0,
+			after:   []string{"log", "cache"},
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				return L.InitDBQueryE(cfg.DB)
+			},
+		},
+		{
+			name:     "http_query",
+			enabled:  cfg.HTTPQuery != nil,
+			requires: []string{"cache"},
+			after:    []string{"log"},
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				return L.InitHTTPQueryE(cfg.HTTPQuery.Log)
+			},
+		},
+		{
+			name:    "microservice",
+			enabled: cfg.Microservice != nil,
+			after:   []string{"log"},
+			run:     bootMicroservice,
+		},
+		{
+			name:     "jsonrpc",
+			enabled:  len(cfg.RPC) > 0,
+			requires: rpcrequires,
+			after:    []string{"microservice"},
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.InitJSONRPC(cfg.RPC)
+				return nil
+			},
+		},
+		{
+			name:    "sse",
+			enabled: cfg.SSE != nil && cfg.SSE.Enable,
+			run: func(L *Letsgo, cfg *config.BootConfig) error {
+				L.InitHTTPSSEServer()
+				return nil
+			},
+		},
+	}
+}
+
+// sortBootSteps 过滤未启用的步骤并按依赖关系拓扑排序，同级保持声明顺序
+func sortBootSteps(steps []bootStep) ([]bootStep, error) {
+	enabled := make(map[string]bool)
+	for _, step := range steps {
+		enabled[step.name] = step.enabled
+	}
+
+	var active []bootStep
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+		for _, dep := range step.requires {
+			if !enabled[dep] {
+				return nil, fmt.Errorf("[error]Bootstrap %s requires section '%s' in config", step.name, dep)
+			}
+		}
+		active = append(active, step)
+	}
+
+	done := make(map[string]bool)
+	var sorted []bootStep
+	for len(sorted) < len(active) {
+		progress := false
+		for _, step := range active {
+			if done[step.name] {
+				continue
+			}
+			ready := true
+			for _, dep := range append(append([]string{}, step.requires...), step.after...) {
+				if enabled[dep] && !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[step.name] = true
+				sorted = append(sorted, step)
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("[error]Bootstrap dependency cycle between init steps")
+		}
+	}
+	return sorted, nil
+}
+
+// bootCache 初始化memcached、redis及其他命名缓存后端
+func bootCache(L *Letsgo, cfg *config.BootConfig) error {
+	c := cfg.Cache
+	if c.Memcached == nil && c.Redis == nil && len(c.Backends) == 0 {
+		return fmt.Errorf("cache section needs memcached, redis or backends")
+	}
+	if c.Memcached != nil {
+		if _, err := bootCacheBackend(L, CacheMemcached, config.CacheBackendBootConfig{Memcached: c.Memcached, Codec: c.Codec, Compress: c.Compress, Namespace: c.Namespace, SchemaVersion: c.SchemaVersion}); err != nil {
+			return err
+		}
+	}
+	if c.Redis != nil {
+		if _, err := bootCacheBackend(L, CacheRedis, config.CacheBackendBootConfig{Redis: c.Redis, Codec: c.Codec, Compress: c.Compress, Namespace: c.Namespace, SchemaVersion: c.SchemaVersion}); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(c.Backends))
+	for name := range c.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		backend := c.Backends[name]
+		if backend.Namespace == "" {
+			backend.Namespace = c.Namespace
+		}
+		backend.SchemaVersion = backend.SchemaVersion || c.SchemaVersion
+		if _, err := bootCacheBackend(L, name, backend); err != nil {
+			return err
+		}
+	}
+
+	defaultname := c.Default
+	if defaultname == "" && c.Redis != nil {
+		defaultname = CacheRedis
+	}
+	if defaultname != "" {
+		if err := L.SetDefaultCache(defaultname); err != nil {
+			return err
+		}
+	}
+	if c.Local != nil {
+		enableLocalCache(L.Cache, c.Local)
+	}
+	return nil
+}
+
+// bootCacheBackend 初始化名为name的缓存后端
+func bootCacheBackend(L *Letsgo, name string, c config.CacheBackendBootConfig) (*Cache, error) {
+	var codec Codec
+	if c.Codec != "" {
+		var err error
+		if codec, err = CodecByName(c.Codec); err != nil {
+			return nil, fmt.Errorf("cache '%s': %w", name, err)
+		}
+	}
+	var compress *CompressOptions
+	if c.Compress != nil {
+		compressor, err := CompressorByName(c.Compress.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("cache '%s': %w", name, err)
+		}
+		compress = &CompressOptions{Compressor: compressor, Threshold: c.Compress.Threshold}
+	}
+	var cache *Cache
+	switch {
+	case c.Memcached != nil && c.Redis != nil:
+		return nil, fmt.Errorf("cache '%s': only one of memcached and redis can be configured", name)
+	case c.Memcached != nil:
+		if len(c.Memcached.Hosts) == 0 {
+			return nil, fmt.Errorf("cache '%s': memcached hosts empty", name)
+		}
+		cache = L.InitNamedMemcached(name, c.Memcached.Hosts, c.Memcached.MaxIdleConns, c.Memcached.Timeout.Std())
+	case c.Redis != nil:
+		if len(c.Redis.Servers) == 0 {
+			return nil, fmt.Errorf("cache '%s': redis servers empty", name)
+		}
+		var err error
+		if cache, err = L.initNamedRedisE(name, c.Redis.Type, c.Redis.Servers, redisDialOptions(c.Redis), sentinelOptions(c.Redis)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cache '%s' needs memcached or redis", name)
+	}
+	cache.Codec = codec
+	cache.Compress = compress
+	cache.Namespace = c.Namespace
+	cache.AutoSchemaVersion = c.SchemaVersion
+	if c.Local != nil {
+		enableLocalCache(cache, c.Local)
+	}
+	return cache, nil
+}
+
+// enableLocalCache 按配置为cache启用进程内一级缓存
+func enableLocalCache(cache *Cache, c *config.LocalCacheBootConfig) {
+	cache.EnableLocalCache(LocalCacheOptions{
+		MaxEntries:        c.MaxEntries,
+		TTL:               c.TTL.Std(),
+		Prefixes:          c.Prefixes,
+		InvalidateChannel: c.InvalidateChannel,
+	})
+}
+
+// redisDialOptions 将配置转换为redis.DialOption
+func redisDialOptions(c *config.RedisBootConfig) []redis.DialOption {
+	var options []redis.DialOption
+	if c.Password != "" {
+		options = append(options, redis.DialPassword(c.Password))
+	}
+	if c.DB != 0 {
+		options = append(options, redis.DialDatabase(c.DB))
+	}
+	if c.ConnectTimeout != 0 {
+		options = append(options, redis.DialConnectTimeout(c.ConnectTimeout.Std()))
+	}
+	if c.ReadTimeout != 0 {
+		options = append(options, redis.DialReadTimeout(c.ReadTimeout.Std()))
+	}
+	if c.WriteTimeout != 0 {
+		options = append(options, redis.DialWriteTimeout(c.WriteTimeout.Std()))
+	}
+	return options
+}
+
+// sentinelOptions 按配置生成sentinel模式的选项，sentinel的连接超时与redis一致
+func sentinelOptions(c *config.RedisBootConfig) SentinelOptions {
+	opts := SentinelOptions{ReadFromReplicas: c.ReadFromReplicas}
+	if c.SentinelPassword != "" {
+		opts.DialOptions = append(opts.DialOptions, redis.DialPassword(c.SentinelPassword))
+	}
+	if c.ConnectTimeout != 0 {
+		opts.DialOptions = append(opts.DialOptions, redis.DialConnectTimeout(c.ConnectTimeout.Std()))
+	}
+	if c.ReadTimeout != 0 {
+		opts.DialOptions = append(opts.DialOptions, redis.DialReadTimeout(c.ReadTimeout.Std()))
+	}
+	if c.WriteTimeout != 0 {
+		opts.DialOptions = append(opts.DialOptions, redis.DialWriteTimeout(c.WriteTimeout.Std()))
+	}
+	return opts
+}
+
+// bootMicroservice 初始化微服务客户端
+func bootMicroservice(L *Letsgo, cfg *config.BootConfig) error {
+	switch cfg.Microservice.Type {
+	case "consul", "":
+		client := NewConsulClient()
+		client.DeregisterBeforeExit(cfg.Microservice.DeregisterBeforeExit)
+		return L.InitMicroserviceClientE(client)
+	default:
+		return fmt.Errorf("unsupported microservice type '%s'", cfg.Microservice.Type)
+	}
+}
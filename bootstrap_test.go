@@ -0,0 +1,79 @@
+package letsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortBootSteps(t *testing.T) {
+	step := func(name string, enabled bool, requires []string, after []string) bootStep {
+		return bootStep{name: name, enabled: enabled, requires: requires, after: after}
+	}
+	tests := []struct {
+		name    string
+		steps   []bootStep
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "keeps declaration order without dependencies",
+			steps: []bootStep{step("log", true, nil, nil), step("db", true, nil, nil)},
+			want:  []string{"log", "db"},
+		},
+		{
+			name:  "requires runs dependency first",
+			steps: []bootStep{step("cachelock", true, []string{"cache"}, nil), step("cache", true, nil, nil)},
+			want:  []string{"cache", "cachelock"},
+		},
+		{
+			name:  "after orders enabled dependency",
+			steps: []bootStep{step("db", true, nil, []string{"log"}), step("log", true, nil, nil)},
+			want:  []string{"log", "db"},
+		},
+		{
+			name:  "after ignores disabled dependency",
+			steps: []bootStep{step("db", true, nil, []string{"log"}), step("log", false, nil, nil)},
+			want:  []string{"db"},
+		},
+		{
+			name:  "disabled steps skipped",
+			steps: []bootStep{step("log", false, nil, nil), step("cachelock", false, []string{"cache"}, nil)},
+			want:  nil,
+		},
+		{
+			name:    "requires disabled section",
+			steps:   []bootStep{step("cachelock", true, []string{"cache"}, nil), step("cache", false, nil, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "requires unknown section",
+			steps:   []bootStep{step("cachelock", true, []string{"cache"}, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "requires cycle",
+			steps:   []bootStep{step("a", true, []string{"b"}, nil), step("b", true, []string{"a"}, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "after cycle",
+			steps:   []bootStep{step("a", true, nil, []string{"c"}), step("b", true, nil, []string{"a"}), step("c", true, nil, []string{"b"})},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortBootSteps(tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sortBootSteps error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, s := range sorted {
+				got = append(got, s.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("sortBootSteps order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
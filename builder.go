@@ -5,6 +5,7 @@ package letsgo
  */
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"strconv"
@@ -41,6 +42,7 @@ type HTTPRequest struct {
 	URL       string
 	Header    map[string]string
 	Postdata  map[string]interface{}
+	ctx       context.Context //携带链路追踪信息，由HTTPQuery.Run设置
 }
 
 // HTTPResponseResult http响应结构体
@@ -52,6 +54,7 @@ type HTTPResponseResult struct {
 	HTTPStatusCode int
 	ContentLength  int64
 	Body           []byte
+	err            error //读取缓存失败
 }
 
 // HTTPQueryBuilder 包含请求和多个响应channel的结构体
@@ -59,6 +62,9 @@ type HTTPQueryBuilder struct {
 	Requests        []HTTPRequest
 	ResponseCH      chan HTTPResponseResult
 	CacheExpireTime int32
+	CacheName       string //使用的缓存后端名称，为空使用默认后端
+	LoadLock        bool   //缓存未命中时是否使用CacheLock跨实例合并请求
+	SoftExpireTime  int32  //软过期秒数，超过后先返回旧值并异步刷新，为0不启用
 	*CommonParams
 }
 
@@ -118,6 +124,21 @@ func (httpm *HTTPQueryBuilder) SetCacheExpire(ExpireTime int32) {
 	httpm.CacheExpireTime = ExpireTime
 }
 
+// SetCacheName 设置使用的缓存后端名称
+func (httpm *HTTPQueryBuilder) SetCacheName(name string) {
+	httpm.CacheName = name
+}
+
+// SetLoadLock 设置缓存未命中时是否使用CacheLock跨实例合并请求，需已初始化CacheLock
+func (httpm *HTTPQueryBuilder) SetLoadLock(use bool) {
+	httpm.LoadLock = use
+}
+
+// SetSoftExpire 设置软过期秒数，需小于缓存超时；超过后先返回旧值并在后台刷新，刷新失败时继续返回旧值直到缓存超时
+func (httpm *HTTPQueryBuilder) SetSoftExpire(SoftExpireTime int32) {
+	httpm.SoftExpireTime = SoftExpireTime
+}
+
 // InitHTTP 初始化http相关
 func (httpm *HTTPQueryBuilder) InitHTTP() {
 	httpm.ResponseCH = make(chan HTTPResponseResult, config.CACHEHTTP_CHANNEL_BUFFER_LEN)
@@ -138,13 +159,18 @@ func (httpm *HTTPQueryBuilder) GetDebugInfo() *DebugInfo {
 
 // DBQueryBuilder 数据库模块结构体
 type DBQueryBuilder struct {
-	UseCache        bool
-	CacheKey        string
-	CacheExpireTime int32
-	SQL             string
-	SQLcondition    []interface{}
-	Result          interface{}
-	DBName          string
+	UseCache           bool
+	CacheKey           string
+	CacheExpireTime    int32
+	SQL                string
+	SQLcondition       []interface{}
+	Result             interface{}
+	DBName             string
+	CacheName          string   //使用的缓存后端名称，为空使用默认后端
+	LoadLock           bool     //缓存未命中时是否使用CacheLock跨实例合并查询
+	SoftExpireTime     int32    //软过期秒数，超过后先返回旧值并异步刷新，为0不启用
+	CacheTags          []string //缓存标签，Cache.InvalidateTags使任一标签失效后缓存视为未命中
+	NegativeExpireTime int32    //查询结果为空时缓存不存在标记的秒数，为0不缓存
 	*CommonParams
 }
 
@@ -166,6 +192,31 @@ func (dbm *DBQueryBuilder) SetCacheKey(CacheKey string) {
 	}
 }
 
+// SetCacheName 设置使用的缓存后端名称
+func (dbm *DBQueryBuilder) SetCacheName(name string) {
+	dbm.CacheName = name
+}
+
+// SetLoadLock 设置缓存未命中时是否使用CacheLock跨实例合并查询，需已初始化CacheLock
+func (dbm *DBQueryBuilder) SetLoadLock(use bool) {
+	dbm.LoadLock = use
+}
+
+// SetSoftExpire 设置软过期秒数，需小于缓存超时；超过后先返回旧值并在后台刷新，刷新失败时继续返回旧值直到缓存超时
+func (dbm *DBQueryBuilder) SetSoftExpire(SoftExpireTime int32) {
+	dbm.SoftExpireTime = SoftExpireTime
+}
+
+// SetNegativeExpire 设置查询结果为空时缓存不存在标记的秒数，应远小于缓存超时，之后写入该key时自动覆盖标记
+func (dbm *DBQueryBuilder) SetNegativeExpire(NegativeExpireTime int32) {
+	dbm.NegativeExpireTime = NegativeExpireTime
+}
+
+// SetCacheTags 为缓存加上标签，数据变更后调用Cache.InvalidateTags使带有该标签的全部查询缓存失效
+func (dbm *DBQueryBuilder) SetCacheTags(tags ...string) {
+	dbm.CacheTags = append(dbm.CacheTags, tags...)
+}
+
 // GetCacheExpire 得到缓存超时信息
 func (dbm *DBQueryBuilder) GetCacheExpire() int32 {
 	return dbm.CacheExpireTime
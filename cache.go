@@ -1,18 +1,96 @@
 package letsgo
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	jsoniter "github.com/json-iterator/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // Cache 结构体
 type Cache struct {
+	Name                string //注册到Letsgo.Caches中的名称
 	Memcached           *Lmemcache
 	Redis               Lrediser
-	UseRedisOrMemcached int //使用哪种缓存 1-memcached 2-redis
+	UseRedisOrMemcached int              //使用哪种缓存 1-memcached 2-redis
+	Codec               Codec            //Get/Set使用的编码器，为空使用JSONCodec
+	Compress            *CompressOptions //超过阈值的值压缩后写入，为空不压缩，读取时按头部自动解压
+	Namespace           string           //远端key的命名空间前缀，多个服务共用redis或memcached时避免key冲突，需在EnableLocalCache前设置
+	AutoSchemaVersion   bool             //按DataStruct类型的结构指纹为key加上版本，结构变更后旧缓存不再命中
+	Metrics             *Metrics
+	Tracer              trace.Tracer
+	Logger              *slog.Logger
+	Local               *LocalCache //进程内一级缓存，通过EnableLocalCache启用，只读，运行期间通过localCache读取
+	local               atomic.Pointer[LocalCache]
+	localSub            *Subscription //一级缓存的失效广播订阅
+	localLock           sync.Mutex
+	loadGroup           singleflight.Group //GetOrLoad合并同一key的并发加载
+	refreshing          sync.Map           //正在后台刷新的key
+	refreshCount        atomic.Int64       //在途的后台刷新数量，计入Letsgo.InFlight
+	versioned           atomic.Bool        //已使用过带版本号的key，此后Delete、MDelete必须指定WithSchema
+}
+
+// CacheOption 单次缓存调用的可选参数
+type CacheOption func(*cacheOptions)
+
+// cacheOptions 单次缓存调用的参数集合
+type cacheOptions struct {
+	ctx         context.Context
+	skipLocal   bool
+	codec       Codec
+	loadLock    *CacheLock
+	loadTimeout time.Duration
+	softTTL     time.Duration
+	tags        []string
+	tagGens     map[string]int64
+	schema      interface{}
+	negativeTTL time.Duration
+	negative    bool
+}
+
+// WithContext 传入携带链路追踪信息的context，缓存操作将作为其子span
+func WithContext(ctx context.Context) CacheOption {
+	return func(o *cacheOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithoutLocal 本次调用跳过进程内一级缓存
+func WithoutLocal() CacheOption {
+	return func(o *cacheOptions) {
+		o.skipLocal = true
+	}
+}
+
+// WithCodec 本次调用使用codec编码，读取时按缓存值头部自动选择编码器，codec仅用于没有头部的旧值
+func WithCodec(codec Codec) CacheOption {
+	return func(o *cacheOptions) {
+		o.codec = codec
+	}
+}
+
+// WithSoftTTL 写入时设置软过期时间，GetOrLoad读到已软过期的值时先返回旧值并异步刷新，刷新失败时继续返回旧值直到过期
+func WithSoftTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.softTTL = ttl
+	}
+}
+
+// newCacheOptions 合并可选参数
+func newCacheOptions(opts []CacheOption) cacheOptions {
+	o := cacheOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
 // newCache 返回一个Cache结构体指针
@@ -31,54 +109,123 @@ func (c *Cache) Init() {
 }
 
 // Get 获得缓存
-func (c *Cache) Get(cachekey string, DataStruct interface{}) (bool, error) {
-	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	CacheGet := false
-	var err error
+func (c *Cache) Get(cachekey string, DataStruct interface{}, opts ...CacheOption) (bool, error) {
+	isget, _, err := c.getEntry(cachekey, DataStruct, newCacheOptions(opts))
+	return isget, err
+}
+
+// getEntry 获得缓存并返回其元数据，数据不存在的标记返回false及Negative为true的元数据
+func (c *Cache) getEntry(cachekey string, DataStruct interface{}, o cacheOptions) (bool, entryMeta, error) {
+	cachekey = c.schemaKey(cachekey, schemaType(DataStruct, o))
+	_, span := startSpan(c.Tracer, o.ctx, "cache.get", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.String("cache.key", cachekey)))
+
+	local := c.localCache()
+	uselocal := c.useLocal(local, cachekey, o)
+	if uselocal {
+		if meta, ok := c.getLocal(local, cachekey, DataStruct, o); ok {
+			span.SetAttributes(attribute.Bool("cache.hit", !meta.Negative), attribute.Bool("cache.local", true))
+			span.End()
+			return !meta.Negative, meta, nil
+		}
+	}
+
+	var meta entryMeta
+	data, isget, err := c.get(cachekey)
+	if isget && err == nil {
+		if data, err = decompressValue(data); err == nil {
+			if meta, _, err = unwrapMeta(data); err == nil {
+				var current bool
+				if current, err = c.tagsCurrent(meta); err == nil && !current {
+					isget, meta = false, entryMeta{}
+				} else if err == nil && meta.Negative {
+					isget = false
+				} else if err == nil {
+					err = decodeValue(data, DataStruct, c.legacyCodec(o))
+				}
+			}
+		}
+		if err != nil {
+			isget, meta = false, entryMeta{}
+			err = fmt.Errorf("[error]Cache %s decode cache: %s", c.backend(), err.Error())
+		}
+	}
+	if uselocal && (isget || meta.Negative) && err == nil {
+		local.Set(cachekey, data, 0)
+	}
+	result := "miss"
+	if err != nil {
+		result = "error"
+	} else if isget {
+		result = "hit"
+	} else if meta.Negative {
+		result = "negative"
+	}
+	c.Metrics.ObserveCache(c.backend(), cachekey, "get", result)
+	span.SetAttributes(attribute.Bool("cache.hit", isget))
+	c.finish(span, "get", cachekey, err)
+	return isget, meta, err
+}
+
+func (c *Cache) get(cachekey string) ([]byte, bool, error) {
 	switch c.UseRedisOrMemcached {
 	case 1:
-		CacheGet, err = c.Memcached.Get(cachekey, DataStruct)
+		data, isget, err := c.Memcached.GetBytes(c.Key(cachekey))
 		if err != nil {
-			return false, fmt.Errorf("[error]Cache Memcached get cache: %s", err.Error())
+			return nil, false, fmt.Errorf("[error]Cache Memcached get cache: %s", err.Error())
 		}
+		return data, isget, nil
 	case 2:
 		conn := c.Redis.GetConn(true)
 		defer conn.Close()
 
-		isexist, err := redis.Int(conn.Do("EXISTS", cachekey))
-		if err != nil {
-			return false, fmt.Errorf("[error]Cache Redisc exists cmd: %s", err.Error())
-		}
-		if isexist == 0 {
-			return false, nil
-		}
-		s, err := redis.String(conn.Do("GET", cachekey))
+		data, err := redis.Bytes(conn.Do("GET", c.Key(cachekey)))
 		if err != nil {
 			if err == redis.ErrNil {
-				return false, nil
+				return nil, false, nil
 			}
-			return false, fmt.Errorf("[error]Cache Redisc get cache: %s", err.Error())
+			return nil, false, fmt.Errorf("[error]Cache Redisc get cache: %s", err.Error())
 		}
 
-		if s == "" {
-			return false, fmt.Errorf("[error]Cache Redisc get cache empty")
+		if len(data) == 0 {
+			return nil, false, fmt.Errorf("[error]Cache Redisc get cache empty")
 		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
 
-		if err := json.UnmarshalFromString(s, DataStruct); err != nil {
-			return false, fmt.Errorf("[error]Cache Redisc get cache: %s", err.Error())
+// Set 设置缓存
+func (c *Cache) Set(cachekey string, DataStruct interface{}, expire int32, opts ...CacheOption) error {
+	o := newCacheOptions(opts)
+	cachekey = c.schemaKey(cachekey, schemaType(DataStruct, o))
+	_, span := startSpan(c.Tracer, o.ctx, "cache.set", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.String("cache.key", cachekey)))
+
+	data, err := c.encodeEntry(DataStruct, o)
+	if err != nil {
+		err = fmt.Errorf("[error]Cache %s marshall struct: %s", c.backend(), err.Error())
+	} else {
+		var stored []byte
+		if stored, err = c.compress(data); err == nil {
+			err = c.set(cachekey, stored, expire)
 		}
-
-		CacheGet = true
 	}
-	return CacheGet, nil
+	if local := c.localCache(); c.useLocal(local, cachekey, o) {
+		if err == nil {
+			local.Set(cachekey, data, time.Duration(expire)*time.Second)
+		} else {
+			local.Delete(cachekey)
+		}
+		c.broadcastInvalidate(local, cachekey)
+	}
+	c.Metrics.ObserveCache(c.backend(), cachekey, "set", okOrError(err))
+	c.finish(span, "set", cachekey, err)
+	return err
 }
 
-// Set 设置缓存
-func (c *Cache) Set(cachekey string, DataStruct interface{}, expire int32) error {
-	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+func (c *Cache) set(cachekey string, data []byte, expire int32) error {
 	switch c.UseRedisOrMemcached {
 	case 1:
-		err := c.Memcached.Set(cachekey, DataStruct, expire)
+		err := c.Memcached.SetBytes(c.Key(cachekey), data, expire)
 		if err != nil {
 			return fmt.Errorf("[error]Cache Memcached set cache: %s", err.Error())
 		}
@@ -86,24 +233,95 @@ func (c *Cache) Set(cachekey string, DataStruct interface{}, expire int32) error
 		conn := c.Redis.GetConn(true)
 		defer conn.Close()
 
-		str, err := json.MarshalToString(DataStruct)
+		_, err := conn.Do("SET", c.Key(cachekey), data, "EX", expire)
 		if err != nil {
-			return fmt.Errorf("[error]Cache Redisc marshall struct: %s", err.Error())
+			return fmt.Errorf("[error]Cache Redisc set cache: %s", err.Error())
 		}
+	}
+	return nil
+}
 
-		_, err2 := conn.Do("SET", cachekey, str, "EX", expire)
-		if err2 != nil {
-			return fmt.Errorf("[error]Cache Redisc set cache: %s", err2.Error())
+// compress 按Compress配置压缩编码后的值并记录压缩率
+func (c *Cache) compress(data []byte) ([]byte, error) {
+	stored, ratio, err := compressValue(c.Compress, data)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Cache %s compress: %s", c.backend(), err.Error())
+	}
+	if ratio > 0 {
+		c.Metrics.ObserveCacheCompression(c.backend(), c.Compress.Compressor.Name(), ratio)
+	}
+	return stored, nil
+}
+
+// encodeEntry 编码DataStruct，按WithSoftTTL加上软过期时间，按WithTags加上标签版本号，写入数据不存在的标记时只有元数据
+func (c *Cache) encodeEntry(DataStruct interface{}, o cacheOptions) ([]byte, error) {
+	var data []byte
+	var meta entryMeta
+	var err error
+	if o.negative {
+		meta.Negative = true
+	} else if data, err = encodeValue(c.codec(o), DataStruct); err != nil {
+		return nil, err
+	}
+	if o.softTTL > 0 && !o.negative {
+		meta.SoftExpire = time.Now().Add(o.softTTL).UnixMilli()
+	}
+	if len(o.tags) > 0 {
+		if meta.Tags = o.tagGens; meta.Tags == nil {
+			if meta.Tags, err = c.tagGens(o.tags); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return nil
+	return wrapMeta(meta, data)
+}
+
+// codec 本次调用写入使用的编码器
+func (c *Cache) codec(o cacheOptions) Codec {
+	if o.codec != nil {
+		return o.codec
+	}
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return JSONCodec{}
+}
+
+// legacyCodec 解码没有编码器头部的旧值，WithCodec优先，否则按旧版本的写入方式：memcached使用gob，redis使用json
+func (c *Cache) legacyCodec(o cacheOptions) Codec {
+	if o.codec != nil {
+		return o.codec
+	}
+	if c.UseRedisOrMemcached == 1 {
+		return GobCodec{}
+	}
+	return JSONCodec{}
 }
 
-// Delete 删除缓存
-func (c *Cache) Delete(cachekey string) error {
+// Delete 删除缓存，DataStruct的类型有版本号时需通过WithSchema指定类型，开启AutoSchemaVersion或已使用过带版本号的key时未指定返回错误
+func (c *Cache) Delete(cachekey string, opts ...CacheOption) error {
+	o := newCacheOptions(opts)
+	typ, err := c.deleteSchemaType(o)
+	if err != nil {
+		return err
+	}
+	cachekey = c.schemaKey(cachekey, typ)
+	_, span := startSpan(c.Tracer, o.ctx, "cache.delete", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.String("cache.key", cachekey)))
+
+	err = c.delete(cachekey)
+	if local := c.localCache(); c.useLocal(local, cachekey, o) {
+		local.Delete(cachekey)
+		c.broadcastInvalidate(local, cachekey)
+	}
+	c.Metrics.ObserveCache(c.backend(), cachekey, "delete", okOrError(err))
+	c.finish(span, "delete", cachekey, err)
+	return err
+}
+
+func (c *Cache) delete(cachekey string) error {
 	switch c.UseRedisOrMemcached {
 	case 1:
-		err := c.Memcached.Delete(cachekey)
+		err := c.Memcached.Delete(c.Key(cachekey))
 		if err != nil {
 			return fmt.Errorf("[error]Cache Memcached delete cache: %s", err.Error())
 		}
@@ -111,7 +329,7 @@ func (c *Cache) Delete(cachekey string) error {
 		conn := c.Redis.GetConn(true)
 		defer conn.Close()
 
-		_, err2 := conn.Do("DEL", cachekey)
+		_, err2 := conn.Do("DEL", c.Key(cachekey))
 		if err2 != nil {
 			return fmt.Errorf("[error]Cache Redisc delete cache: %s", err2.Error())
 		}
@@ -120,6 +338,14 @@ func (c *Cache) Delete(cachekey string) error {
 	return nil
 }
 
+// finish 记录失败的缓存操作并结束span
+func (c *Cache) finish(span trace.Span, op string, cachekey string, err error) {
+	if err != nil {
+		loggerOr(c.Logger).Warn("Cache "+op, slog.String("backend", c.backend()), slog.String("key", cachekey), slog.Any("error", err))
+	}
+	endSpan(span, err)
+}
+
 // SetNX only for redis distribut lock
 func (c *Cache) SetNX(cachekey string, owner string, expire int32) (int, error) {
 	switch c.UseRedisOrMemcached {
@@ -129,7 +355,7 @@ func (c *Cache) SetNX(cachekey string, owner string, expire int32) (int, error)
 		conn := c.Redis.GetConn(true)
 		defer conn.Close()
 
-		_, err2 := redis.String(conn.Do("SET", cachekey, owner, "NX", "PX", expire))
+		_, err2 := redis.String(conn.Do("SET", c.Key(cachekey), owner, "NX", "PX", expire))
 
 		if err2 == redis.ErrNil {
 			// The lock was not successful, it already exists.
@@ -154,7 +380,7 @@ func (c *Cache) BRPOP(cachekey string, DataStruct interface{}, timeout int32) (b
 		conn := c.Redis.GetConn(true)
 		defer conn.Close()
 
-		s, err := redis.ByteSlices(conn.Do("BRPOP", cachekey, timeout))
+		s, err := redis.ByteSlices(conn.Do("BRPOP", c.Key(cachekey), timeout))
 		if err != nil {
 			if err != redis.ErrNil {
 				return false, fmt.Errorf("[error]Cache Redisc BRPOP %s", err.Error())
@@ -188,7 +414,7 @@ func (c *Cache) LPUSH(cachekey string, DataStruct interface{}) (int, error) {
 			return 0, fmt.Errorf("[error]Cache Redisc marshall struct: %s", err.Error())
 		}
 
-		s, err := redis.Int(conn.Do("LPUSH", cachekey, str))
+		s, err := redis.Int(conn.Do("LPUSH", c.Key(cachekey), str))
 		if err != nil {
 			return 0, fmt.Errorf("[error]Cache Redisc LPUSH %s", err.Error())
 		}
@@ -198,7 +424,7 @@ func (c *Cache) LPUSH(cachekey string, DataStruct interface{}) (int, error) {
 	return 0, nil
 }
 
-// DO only for redis
+// DO only for redis，参数中的key不会加上Namespace，需使用Key转换
 func (c *Cache) DO(CMD string, Params ...interface{}) (interface{}, error) {
 	switch c.UseRedisOrMemcached {
 	case 1:
@@ -252,36 +478,64 @@ func (c *Cache) SUB(psc *redis.PubSubConn) (string, error) {
 	case 1:
 		return "", fmt.Errorf("Memcached Don't support SUB")
 	case 2:
-		switch n := psc.Receive().(type) {
-		case error:
-			return "", n
-		case redis.Message:
-			return string(n.Data), nil
-		case redis.Subscription: //ignore subsciption message, recursive next
-			return c.SUB(psc)
+		for {
+			switch n := psc.Receive().(type) {
+			case error:
+				return "", n
+			case redis.Message:
+				return string(n.Data), nil
+			} //ignore subscription and pong message, receive next
 		}
 	}
 	return "", nil
 }
 
-// SUB only for redis and use timeout param，you should use in "for" loop statment for sub
+// TIMEOUTSUB only for redis and use timeout param，you should use in "for" loop statment for sub
 func (c *Cache) TIMEOUTSUB(psc *redis.PubSubConn, timeout time.Duration) (string, error) {
 	switch c.UseRedisOrMemcached {
 	case 1:
 		return "", fmt.Errorf("Memcached Don't support SUB")
 	case 2:
-		switch n := psc.ReceiveWithTimeout(timeout).(type) {
-		case error:
-			return "", n
-		case redis.Message:
-			return string(n.Data), nil
-		case redis.Subscription: //ignore subsciption message, recursive next
-			return c.SUB(psc)
+		for {
+			switch n := psc.ReceiveWithTimeout(timeout).(type) {
+			case error:
+				return "", n
+			case redis.Message:
+				return string(n.Data), nil
+			} //ignore subscription and pong message, receive next
 		}
 	}
 	return "", nil
 }
 
+// backend 缓存后端名称，用于指标标签
+func (c *Cache) backend() string {
+	switch c.UseRedisOrMemcached {
+	case 1:
+		return "memcached"
+	case 2:
+		return "redis"
+	}
+	return "none"
+}
+
+// okOrError 将错误转换为指标结果标签
+func okOrError(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Close 停止一级缓存失效订阅并关闭redis连接池
+func (c *Cache) Close() error {
+	c.DisableLocalCache()
+	if c.Redis != nil {
+		return c.Redis.Close()
+	}
+	return nil
+}
+
 // Show 显示设置
 func (c *Cache) Show() string {
 	switch c.UseRedisOrMemcached {
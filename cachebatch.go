@@ -0,0 +1,389 @@
+package letsgo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MGet 批量获得缓存，返回每个key是否命中
+// DataStruct可以是map[string]T、*map[string]T（为nil时自动创建）或*[]T（按keys的顺序填充，未命中的位置为零值）
+// redis cluster下按slot拆分为多次MGET，一级缓存命中的key不再访问远端，远端命中的key回写一级缓存
+func (c *Cache) MGet(cachekeys []string, DataStruct interface{}, opts ...CacheOption) (map[string]bool, error) {
+	o := newCacheOptions(opts)
+	_, span := startSpan(c.Tracer, o.ctx, "cache.mget", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.Int("cache.keys", len(cachekeys))))
+
+	hits := make(map[string]bool, len(cachekeys))
+	target, err := newBatchTarget(DataStruct, len(cachekeys))
+	if err != nil {
+		err = fmt.Errorf("[error]Cache mget: %s", err.Error())
+		c.finish(span, "mget", "", err)
+		return hits, err
+	}
+
+	//先读一级缓存，remote为仍需访问远端的key在cachekeys中的位置，entrykeys为加上版本号后的key
+	typ := schemaType(nil, o)
+	if typ == nil {
+		typ = target.elem
+	}
+	local := c.localCache()
+	entrykeys := make([]string, len(cachekeys))
+	var remote []int
+	var remotekeys []string
+	for k, cachekey := range cachekeys {
+		hits[cachekey] = false
+		entrykey := c.schemaKey(cachekey, typ)
+		entrykeys[k] = entrykey
+		if c.useLocal(local, entrykey, o) {
+			if value, ok := local.Get(entrykey); ok && c.decodeCurrent(target, k, cachekey, value, o) == nil {
+				hits[cachekey] = true
+				c.Metrics.ObserveCache("local", entrykey, "get", "hit")
+				continue
+			}
+			c.Metrics.ObserveCache("local", entrykey, "get", "miss")
+		}
+		remote = append(remote, k)
+		remotekeys = append(remotekeys, entrykey)
+	}
+
+	var values map[string][]byte
+	if len(remotekeys) > 0 {
+		values, err = c.mget(remotekeys)
+	}
+	for _, k := range remote {
+		cachekey, entrykey := cachekeys[k], entrykeys[k]
+		result := "miss"
+		if data, ok := values[entrykey]; ok {
+			var decodeErr error
+			if data, decodeErr = decompressValue(data); decodeErr == nil {
+				decodeErr = c.decodeCurrent(target, k, cachekey, data, o)
+			}
+			if decodeErr == nil {
+				//与Get一致，远端命中回写一级缓存，有效期为一级缓存TTL
+				if c.useLocal(local, entrykey, o) {
+					local.Set(entrykey, data, 0)
+				}
+				hits[cachekey] = true
+				result = "hit"
+			} else if errors.Is(decodeErr, errTagsStale) {
+				result = "miss"
+			} else if errors.Is(decodeErr, errNegativeEntry) {
+				result = "negative"
+			} else {
+				result = "error"
+				if err == nil {
+					err = fmt.Errorf("[error]Cache %s decode cache '%s': %s", c.backend(), entrykey, decodeErr.Error())
+				}
+			}
+		} else if err != nil {
+			result = "error"
+		}
+		c.Metrics.ObserveCache(c.backend(), entrykey, "get", result)
+	}
+
+	hitcount := 0
+	for _, hit := range hits {
+		if hit {
+			hitcount++
+		}
+	}
+	span.SetAttributes(attribute.Int("cache.hits", hitcount))
+	c.finish(span, "mget", "", err)
+	return hits, err
+}
+
+// mget 从远端批量读取原始值，只返回命中的key
+func (c *Cache) mget(cachekeys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(cachekeys))
+	remotekeys, origin := c.remoteKeys(cachekeys)
+	switch c.UseRedisOrMemcached {
+	case 1:
+		items, err := c.Memcached.GetMultiBytes(remotekeys)
+		if err != nil {
+			return nil, fmt.Errorf("[error]Cache Memcached mget cache: %s", err.Error())
+		}
+		for key, data := range items {
+			values[origin[key]] = data
+		}
+	case 2:
+		for _, group := range c.slotGroups(remotekeys) {
+			replies, err := c.doGroup(group, func(conn redis.Conn) (interface{}, error) {
+				return redis.ByteSlices(conn.Do("MGET", redis.Args{}.AddFlat(group)...))
+			})
+			if err != nil {
+				return nil, fmt.Errorf("[error]Cache Redisc mget cache: %s", err.Error())
+			}
+			for k, data := range replies.([][]byte) {
+				if len(data) > 0 {
+					values[origin[group[k]]] = data
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// MSet 批量设置缓存，items的key为缓存key，全部使用相同的过期时间
+// redis下按slot拆分后用pipeline发送SET EX，memcached逐个写入
+func (c *Cache) MSet(items map[string]interface{}, expire int32, opts ...CacheOption) error {
+	o := newCacheOptions(opts)
+	_, span := startSpan(c.Tracer, o.ctx, "cache.mset", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.Int("cache.keys", len(items))))
+
+	//按各值的类型加上版本号
+	entries := make(map[string]interface{}, len(items))
+	for cachekey, DataStruct := range items {
+		entries[c.schemaKey(cachekey, schemaType(DataStruct, o))] = DataStruct
+	}
+	items = entries
+
+	encoded := make(map[string][]byte, len(items))
+	stored := make(map[string][]byte, len(items))
+	var err error
+	for cachekey, DataStruct := range items {
+		data, encErr := c.encodeEntry(DataStruct, o)
+		if encErr != nil {
+			err = fmt.Errorf("[error]Cache %s marshall struct '%s': %s", c.backend(), cachekey, encErr.Error())
+			break
+		}
+		if stored[cachekey], encErr = c.compress(data); encErr != nil {
+			err = encErr
+			break
+		}
+		encoded[cachekey] = data
+	}
+	if err == nil {
+		err = c.mset(stored, expire)
+	}
+
+	local := c.localCache()
+	var localkeys []string
+	for cachekey := range items {
+		if c.useLocal(local, cachekey, o) {
+			if err == nil {
+				local.Set(cachekey, encoded[cachekey], time.Duration(expire)*time.Second)
+			} else {
+				local.Delete(cachekey)
+			}
+			localkeys = append(localkeys, cachekey)
+		}
+		c.Metrics.ObserveCache(c.backend(), cachekey, "set", okOrError(err))
+	}
+	if len(localkeys) > 0 {
+		c.broadcastInvalidate(local, localkeys...)
+	}
+	c.finish(span, "mset", "", err)
+	return err
+}
+
+// mset 将已编码的值批量写入远端
+func (c *Cache) mset(values map[string][]byte, expire int32) error {
+	switch c.UseRedisOrMemcached {
+	case 1:
+		for cachekey, data := range values {
+			if err := c.Memcached.SetBytes(c.Key(cachekey), data, expire); err != nil {
+				return fmt.Errorf("[error]Cache Memcached mset cache: %s", err.Error())
+			}
+		}
+	case 2:
+		keys := make([]string, 0, len(values))
+		for cachekey := range values {
+			keys = append(keys, cachekey)
+		}
+		remotekeys, origin := c.remoteKeys(keys)
+		for _, group := range c.slotGroups(remotekeys) {
+			_, err := c.doGroup(group, func(conn redis.Conn) (interface{}, error) {
+				for _, remotekey := range group {
+					if err := conn.Send("SET", remotekey, values[origin[remotekey]], "EX", expire); err != nil {
+						return nil, err
+					}
+				}
+				if err := conn.Flush(); err != nil {
+					return nil, err
+				}
+				for range group {
+					if _, err := conn.Receive(); err != nil {
+						return nil, err
+					}
+				}
+				return nil, nil
+			})
+			if err != nil {
+				return fmt.Errorf("[error]Cache Redisc mset cache: %s", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// MDelete 批量删除缓存，不存在的key不视为错误，redis cluster下按slot拆分为多次DEL，值的类型有版本号时需通过WithSchema指定类型，未指定时同Delete返回错误
+func (c *Cache) MDelete(cachekeys []string, opts ...CacheOption) error {
+	o := newCacheOptions(opts)
+	typ, err := c.deleteSchemaType(o)
+	if err != nil {
+		return err
+	}
+	_, span := startSpan(c.Tracer, o.ctx, "cache.mdelete", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.Int("cache.keys", len(cachekeys))))
+
+	entrykeys := make([]string, len(cachekeys))
+	for k, cachekey := range cachekeys {
+		entrykeys[k] = c.schemaKey(cachekey, typ)
+	}
+	cachekeys = entrykeys
+
+	err = c.mdelete(cachekeys)
+	local := c.localCache()
+	var localkeys []string
+	for _, cachekey := range cachekeys {
+		if c.useLocal(local, cachekey, o) {
+			localkeys = append(localkeys, cachekey)
+		}
+		c.Metrics.ObserveCache(c.backend(), cachekey, "delete", okOrError(err))
+	}
+	if len(localkeys) > 0 {
+		local.Delete(localkeys...)
+		c.broadcastInvalidate(local, localkeys...)
+	}
+	c.finish(span, "mdelete", "", err)
+	return err
+}
+
+func (c *Cache) mdelete(cachekeys []string) error {
+	switch c.UseRedisOrMemcached {
+	case 1:
+		for _, cachekey := range cachekeys {
+			if err := c.Memcached.Delete(c.Key(cachekey)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+				return fmt.Errorf("[error]Cache Memcached mdelete cache: %s", err.Error())
+			}
+		}
+	case 2:
+		remotekeys, _ := c.remoteKeys(cachekeys)
+		for _, group := range c.slotGroups(remotekeys) {
+			_, err := c.doGroup(group, func(conn redis.Conn) (interface{}, error) {
+				return conn.Do("DEL", redis.Args{}.AddFlat(group)...)
+			})
+			if err != nil {
+				return fmt.Errorf("[error]Cache Redisc mdelete cache: %s", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// remoteKeys 返回cachekeys在远端实际使用的key，origin为远端key到cachekey的映射
+func (c *Cache) remoteKeys(cachekeys []string) ([]string, map[string]string) {
+	remotekeys := make([]string, len(cachekeys))
+	origin := make(map[string]string, len(cachekeys))
+	for k, cachekey := range cachekeys {
+		remotekeys[k] = c.Key(cachekey)
+		origin[remotekeys[k]] = cachekey
+	}
+	return remotekeys, origin
+}
+
+// slotGroups 按redis cluster的slot拆分keys，单机redis不拆分
+func (c *Cache) slotGroups(cachekeys []string) [][]string {
+	if _, ok := c.Redis.(*Lredisc); !ok {
+		return [][]string{cachekeys}
+	}
+	index := make(map[int]int)
+	var groups [][]string
+	for _, cachekey := range cachekeys {
+		slot := redisc.Slot(cachekey)
+		k, ok := index[slot]
+		if !ok {
+			k = len(groups)
+			index[slot] = k
+			groups = append(groups, nil)
+		}
+		groups[k] = append(groups[k], cachekey)
+	}
+	return groups
+}
+
+// doGroup 在一条连接上执行同一slot内keys的批量命令，redis cluster下连接绑定到keys所在的节点
+func (c *Cache) doGroup(group []string, fn func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	conn := c.Redis.GetConn(false)
+	defer conn.Close()
+	if _, ok := c.Redis.(*Lredisc); ok {
+		if err := redisc.BindConn(conn, group[0]); err != nil {
+			return nil, err
+		}
+	}
+	return fn(conn)
+}
+
+// errTagsStale 缓存值的标签已失效
+var errTagsStale = errors.New("cache tags stale")
+
+// errNegativeEntry 缓存值为数据不存在的标记
+var errNegativeEntry = errors.New("cache negative entry")
+
+// decodeCurrent 检查标签版本号后解码到target，标签已失效时返回errTagsStale，数据不存在的标记返回errNegativeEntry
+func (c *Cache) decodeCurrent(target *batchTarget, k int, cachekey string, data []byte, o cacheOptions) error {
+	meta, _, err := unwrapMeta(data)
+	if err != nil {
+		return err
+	}
+	current, err := c.tagsCurrent(meta)
+	if err != nil {
+		return err
+	}
+	if !current {
+		return errTagsStale
+	}
+	if meta.Negative {
+		return errNegativeEntry
+	}
+	return target.decode(k, cachekey, data, c.legacyCodec(o))
+}
+
+// batchTarget MGet解码的目标map或slice
+type batchTarget struct {
+	value reflect.Value //map或slice
+	elem  reflect.Type
+}
+
+// newBatchTarget 检查DataStruct并返回解码目标，n为keys数量
+func newBatchTarget(DataStruct interface{}, n int) (*batchTarget, error) {
+	v := reflect.ValueOf(DataStruct)
+	if v.Kind() == reflect.Map {
+		if v.IsNil() {
+			return nil, fmt.Errorf("DataStruct is a nil map")
+		}
+	} else if v.Kind() == reflect.Ptr && !v.IsNil() && (v.Elem().Kind() == reflect.Map || v.Elem().Kind() == reflect.Slice) {
+		v = v.Elem()
+		if v.Kind() == reflect.Map && v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		}
+	} else {
+		return nil, fmt.Errorf("DataStruct must be a map[string]T, *map[string]T or *[]T, got %T", DataStruct)
+	}
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("DataStruct map key must be string, got %T", DataStruct)
+	}
+	return &batchTarget{value: v, elem: v.Type().Elem()}, nil
+}
+
+// decode 解码data并写入map的cachekey或slice的第k个位置
+func (t *batchTarget) decode(k int, cachekey string, data []byte, legacy Codec) error {
+	ptr := reflect.New(t.elem)
+	if err := decodeValue(data, ptr.Interface(), legacy); err != nil {
+		return err
+	}
+	if t.value.Kind() == reflect.Map {
+		t.value.SetMapIndex(reflect.ValueOf(cachekey).Convert(t.value.Type().Key()), ptr.Elem())
+	} else {
+		t.value.Index(k).Set(ptr.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package letsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewBatchTarget(t *testing.T) {
+	var nilmap map[string]int
+	var slice []int
+	tests := []struct {
+		name     string
+		target   interface{}
+		wantKind reflect.Kind
+		wantElem reflect.Type
+		wantLen  int
+		wantErr  bool
+	}{
+		{"map", map[string]int{}, reflect.Map, reflect.TypeOf(0), 0, false},
+		{"pointer to nil map", &nilmap, reflect.Map, reflect.TypeOf(0), 0, false},
+		{"pointer to slice", &slice, reflect.Slice, reflect.TypeOf(0), 3, false},
+		{"nil map", nilmap, 0, nil, 0, true},
+		{"slice value", []int{}, 0, nil, 0, true},
+		{"struct pointer", &struct{}{}, 0, nil, 0, true},
+		{"nil pointer", (*map[string]int)(nil), 0, nil, 0, true},
+		{"non-string map key", map[int]int{}, 0, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := newBatchTarget(tt.target, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBatchTarget error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if target.value.Kind() != tt.wantKind || target.elem != tt.wantElem {
+				t.Fatalf("newBatchTarget = %s of %s, want %s of %s", target.value.Kind(), target.elem, tt.wantKind, tt.wantElem)
+			}
+			if target.value.IsNil() || target.value.Len() != tt.wantLen {
+				t.Fatalf("newBatchTarget len = %d, want %d", target.value.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestBatchTargetDecode(t *testing.T) {
+	data, err := encodeValue(JSONCodec{}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := map[string]int{}
+	target, err := newBatchTarget(m, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.decode(0, "k", data, JSONCodec{}); err != nil {
+		t.Fatalf("decode returned %v", err)
+	}
+	if m["k"] != 7 {
+		t.Fatalf("map[k] = %d, want 7", m["k"])
+	}
+
+	var s []int
+	if target, err = newBatchTarget(&s, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.decode(1, "k", data, JSONCodec{}); err != nil {
+		t.Fatalf("decode returned %v", err)
+	}
+	if !reflect.DeepEqual(s, []int{0, 7}) {
+		t.Fatalf("slice = %v, want [0 7]", s)
+	}
+}
@@ -0,0 +1,259 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultLoadLockTimeout GetOrLoad分布式锁的默认过期时间及等待其他实例加载的最长时间
+const defaultLoadLockTimeout = 10 * time.Second
+
+// loadPollInterval 等待其他实例加载时读取缓存的间隔
+const loadPollInterval = 50 * time.Millisecond
+
+// LoadFunc GetOrLoad未命中或异步刷新时调用，将数据写入DataStruct，返回false表示数据不存在，此时不写缓存
+// 未命中时DataStruct为调用方传入的值，ctx为调用方的context；异步刷新时DataStruct为新创建的同类型值，ctx不会随请求结束而取消
+type LoadFunc func(ctx context.Context, DataStruct interface{}) (bool, error)
+
+// loadResult 同一进程内合并的加载结果，data为编码后的值，供等待同一key的其他调用方解码
+type loadResult struct {
+	found bool
+	data  []byte
+}
+
+// WithLoadLock GetOrLoad未命中时使用lock保证跨实例同一key只有一个loader执行，其他实例等待其写入缓存
+// timeout为锁的过期时间及最长等待时间，为0时使用10秒，超时后等待方自行加载
+func WithLoadLock(lock *CacheLock, timeout time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.loadLock = lock
+		o.loadTimeout = timeout
+	}
+}
+
+// WithNegativeTTL GetOrLoad的loader返回数据不存在时写入不存在标记，ttl内同一key直接返回false而不再调用loader
+// 标记与正常值使用同一key，之后写入数据时自然覆盖；使用WithTags时标签失效同样清除标记
+func WithNegativeTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// withNegative 写入数据不存在的标记
+func withNegative() CacheOption {
+	return func(o *cacheOptions) {
+		o.negative = true
+	}
+}
+
+// loadOptions DBQuery与HTTPQuery调用GetOrLoad的参数，uselock为true且lock已初始化时跨实例合并加载，softexpire大于0时启用软过期
+func loadOptions(ctx context.Context, lock *CacheLock, uselock bool, softexpire int32) []CacheOption {
+	opts := []CacheOption{WithContext(ctx)}
+	if uselock && lock != nil && lock.Cache != nil {
+		opts = append(opts, WithLoadLock(lock, 0))
+	}
+	if softexpire > 0 {
+		opts = append(opts, WithSoftTTL(time.Duration(softexpire)*time.Second))
+	}
+	return opts
+}
+
+// GetOrLoad 获得缓存，未命中时调用loader加载并写入缓存，返回数据是否存在
+// 同一进程内同一key的并发调用只执行一次loader，其他调用方等待并共享结果；通过WithLoadLock可将范围扩大到全部实例
+// 通过WithSoftTTL写入的值软过期后直接返回旧值并在后台刷新，expire为硬过期时间
+// 通过WithNegativeTTL缓存数据不存在的结果，标记有效期内直接返回false
+// 写缓存失败只记录日志，不影响返回加载的数据
+func (c *Cache) GetOrLoad(cachekey string, DataStruct interface{}, expire int32, loader LoadFunc, opts ...CacheOption) (bool, error) {
+	o := newCacheOptions(opts)
+	isget, meta, err := c.getEntry(cachekey, DataStruct, o)
+	if err != nil || meta.Negative {
+		return false, err
+	}
+	//合并加载以加上版本号后的key区分，同一key不同类型的调用方不共享结果
+	entrykey := c.schemaKey(cachekey, schemaType(DataStruct, o))
+	if isget {
+		if meta.stale(time.Now()) {
+			c.refresh(entrykey, cachekey, reflect.TypeOf(DataStruct), expire, loader, o, opts)
+		}
+		return true, nil
+	}
+
+	leader := false
+	v, err, _ := c.loadGroup.Do(entrykey, func() (interface{}, error) {
+		leader = true
+		return c.load(cachekey, DataStruct, expire, loader, o, opts)
+	})
+	if err != nil {
+		return false, err
+	}
+	res := v.(loadResult)
+	if leader || !res.found {
+		return res.found, nil
+	}
+	if err := decodeValue(res.data, DataStruct, c.legacyCodec(o)); err != nil {
+		return false, fmt.Errorf("[error]Cache %s decode loaded value: %s", c.backend(), err.Error())
+	}
+	return true, nil
+}
+
+// load 由同一key的第一个调用方执行，按需获得分布式锁后调用loader并写入缓存
+func (c *Cache) load(cachekey string, DataStruct interface{}, expire int32, loader LoadFunc, o cacheOptions, opts []CacheOption) (loadResult, error) {
+	_, span := startSpan(c.Tracer, o.ctx, "cache.load", trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.String("cache.key", cachekey)))
+	found, err := c.lockAndLoad(cachekey, DataStruct, expire, loader, o, opts)
+	span.SetAttributes(attribute.Bool("cache.found", found))
+	endSpan(span, err)
+	if err != nil || !found {
+		return loadResult{found: found}, err
+	}
+
+	data, err := encodeValue(c.codec(o), DataStruct)
+	if err != nil {
+		return loadResult{}, fmt.Errorf("[error]Cache %s marshall struct: %s", c.backend(), err.Error())
+	}
+	return loadResult{found: true, data: data}, nil
+}
+
+// lockAndLoad 未使用分布式锁时直接加载；获得锁后再次读取缓存，未获得锁时等待持锁实例写入缓存，超时后自行加载
+func (c *Cache) lockAndLoad(cachekey string, DataStruct interface{}, expire int32, loader LoadFunc, o cacheOptions, opts []CacheOption) (bool, error) {
+	if o.loadLock == nil {
+		return c.runLoader(o.ctx, cachekey, DataStruct, expire, loader, opts)
+	}
+
+	timeout := o.loadTimeout
+	if timeout <= 0 {
+		timeout = defaultLoadLockTimeout
+	}
+	lockkey := "LOCK_LOAD_" + cachekey
+	owner := genRequestID()
+	if o.loadLock.TryLock(lockkey, owner, int(timeout/time.Millisecond), 0) {
+		defer o.loadLock.UnlockKey(lockkey, owner)
+		if isget, done, err := c.lookup(cachekey, DataStruct, o); done {
+			return isget, err
+		}
+		return c.runLoader(o.ctx, cachekey, DataStruct, expire, loader, opts)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(loadPollInterval)
+		if isget, done, err := c.lookup(cachekey, DataStruct, o); done {
+			return isget, err
+		}
+		//持锁实例已结束但没有写入缓存（数据不存在或加载失败），尝试自己持锁加载
+		if o.loadLock.TryLock(lockkey, owner, int(timeout/time.Millisecond), 0) {
+			defer o.loadLock.UnlockKey(lockkey, owner)
+			return c.runLoader(o.ctx, cachekey, DataStruct, expire, loader, opts)
+		}
+	}
+	loggerOr(c.Logger).Warn("Cache load lock wait timeout, loading without lock", slog.String("backend", c.backend()), slog.String("key", cachekey))
+	return c.runLoader(o.ctx, cachekey, DataStruct, expire, loader, opts)
+}
+
+// lookup 读取缓存，done为true表示已命中、已有数据不存在的标记或读取失败，无需再加载
+func (c *Cache) lookup(cachekey string, DataStruct interface{}, o cacheOptions) (isget bool, done bool, err error) {
+	isget, meta, err := c.getEntry(cachekey, DataStruct, o)
+	return isget, isget || meta.Negative || err != nil, err
+}
+
+// runLoader 调用loader并写入缓存，标签版本号在调用loader前读取
+func (c *Cache) runLoader(ctx context.Context, cachekey string, DataStruct interface{}, expire int32, loader LoadFunc, opts []CacheOption) (bool, error) {
+	opts = c.snapshotTags(opts)
+	found, err := loader(ctx, DataStruct)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		c.setNegative(cachekey, DataStruct, opts)
+		return false, nil
+	}
+	c.Set(cachekey, DataStruct, expire, opts...) //失败已由Set记录日志
+	return true, nil
+}
+
+// refresh 在后台重新加载已软过期的key，同一key同时只有一个刷新；使用WithLoadLock时跨实例只有获得锁的实例刷新
+// 刷新失败时保留旧值，数据已不存在时删除缓存或按WithNegativeTTL写入不存在标记，entrykey为加上版本号后的key
+func (c *Cache) refresh(entrykey string, cachekey string, typ reflect.Type, expire int32, loader LoadFunc, o cacheOptions, opts []CacheOption) {
+	if _, loading := c.refreshing.LoadOrStore(entrykey, struct{}{}); loading {
+		return
+	}
+	ctx, span := c.refreshSpan(o.ctx, cachekey)
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+
+	c.refreshCount.Add(1)
+	go func() {
+		defer c.refreshCount.Add(-1)
+		defer c.refreshing.Delete(entrykey)
+		var err error
+		defer func() { endSpan(span, err) }()
+		logger := loggerOr(c.Logger)
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(logger, r)
+			}
+		}()
+
+		if o.loadLock != nil {
+			timeout := o.loadTimeout
+			if timeout <= 0 {
+				timeout = defaultLoadLockTimeout
+			}
+			lockkey := "LOCK_LOAD_" + cachekey
+			owner := genRequestID()
+			if !o.loadLock.TryLock(lockkey, owner, int(timeout/time.Millisecond), 0) {
+				return
+			}
+			defer o.loadLock.UnlockKey(lockkey, owner)
+		}
+
+		if typ.Kind() != reflect.Ptr {
+			return
+		}
+		DataStruct := reflect.New(typ.Elem()).Interface()
+		opts := c.snapshotTags(opts)
+		var found bool
+		found, err = loader(ctx, DataStruct)
+		switch {
+		case err != nil:
+			logger.Warn("Cache refresh failed, serving stale value", slog.String("backend", c.backend()), slog.String("key", cachekey), slog.Any("error", err))
+			c.Metrics.ObserveCache(c.backend(), cachekey, "refresh", "error")
+		case !found:
+			if !c.setNegative(cachekey, DataStruct, opts) {
+				c.Delete(cachekey, append(opts, WithSchema(DataStruct))...)
+			}
+			c.Metrics.ObserveCache(c.backend(), cachekey, "refresh", "miss")
+		default:
+			err = c.Set(cachekey, DataStruct, expire, opts...)
+			c.Metrics.ObserveCache(c.backend(), cachekey, "refresh", okOrError(err))
+		}
+	}()
+}
+
+// refreshSpan 返回后台刷新使用的ctx，不继承已结束请求的span与取消，避免刷新的数据库与HTTP调用挂在请求span下或向下游传递其traceparent
+// 请求处于链路中时创建新的根span并链接到请求span
+func (c *Cache) refreshSpan(reqctx context.Context, cachekey string) (context.Context, trace.Span) {
+	ctx := context.Background()
+	link := trace.LinkFromContext(reqctx)
+	if c.Tracer == nil || !link.SpanContext.IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return c.Tracer.Start(ctx, "cache.refresh",
+		trace.WithNewRoot(),
+		trace.WithLinks(link),
+		trace.WithAttributes(attribute.String("cache.backend", c.backend()), attribute.String("cache.key", cachekey)),
+	)
+}
+
+// setNegative 使用WithNegativeTTL时写入数据不存在的标记，DataStruct只用于决定key的版本号，返回是否已写入
+func (c *Cache) setNegative(cachekey string, DataStruct interface{}, opts []CacheOption) bool {
+	o := newCacheOptions(opts)
+	if o.negativeTTL <= 0 {
+		return false
+	}
+	expire := int32((o.negativeTTL + time.Second - 1) / time.Second)
+	return c.Set(cachekey, DataStruct, expire, append(opts, withNegative())...) == nil //失败已由Set记录日志
+}
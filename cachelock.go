@@ -1,7 +1,7 @@
 package letsgo
 
 import (
-	"log"
+	"log/slog"
 	"math/rand"
 	"strconv"
 	"time"
@@ -9,7 +9,8 @@ import (
 
 // CacheLock 结构体
 type CacheLock struct {
-	Cache *Cache
+	Cache  *Cache
+	Logger *slog.Logger
 }
 
 // newCacheLock 返回一个CacheLock结构体指针
@@ -21,7 +22,7 @@ func newCacheLock() *CacheLock {
 func (c *CacheLock) Lock(lockid int, prefix string, OWNER string, expiremilseconds int) {
 	//必须使用redis
 	if c.Cache.UseRedisOrMemcached == 1 {
-		log.Println("CacheLock must use redis!")
+		loggerOr(c.Logger).Error("CacheLock must use redis")
 		return
 	}
 	lockkey := "LOCK_" + prefix + "_" + strconv.Itoa(lockid)
@@ -48,7 +49,7 @@ func (c *CacheLock) Lock(lockid int, prefix string, OWNER string, expiremilsecon
 func (c *CacheLock) UnlockOld(lockid int, prefix string, OWNER string) {
 	//必须使用redis
 	if c.Cache.UseRedisOrMemcached == 1 {
-		log.Println("CacheLock must use redis!")
+		loggerOr(c.Logger).Error("CacheLock must use redis")
 		return
 	}
 	lockkey := "LOCK_" + prefix + "_" + strconv.Itoa(lockid)
@@ -67,10 +68,8 @@ func (c *CacheLock) UnlockOld(lockid int, prefix string, OWNER string) {
 	return
 }
 
-// Unlock 解锁
-func (c *CacheLock) Unlock(lockid int, prefix string, OWNER string) {
-
-	const LuaCheckAndDeleteDistributionLock = `
+// luaCheckAndDeleteDistributionLock 只有锁的持有者才能删除锁
+const luaCheckAndDeleteDistributionLock = `
 	if redis.call("get",KEYS[1]) == ARGV[1] then
 		return redis.call("del",KEYS[1])
 	else
@@ -78,12 +77,42 @@ func (c *CacheLock) Unlock(lockid int, prefix string, OWNER string) {
 	end
 	`
 
+// Unlock 解锁
+func (c *CacheLock) Unlock(lockid int, prefix string, OWNER string) {
+	c.UnlockKey("LOCK_"+prefix+"_"+strconv.Itoa(lockid), OWNER)
+}
+
+// TryLock 在wait时间内尝试获得名为lockkey的锁，成功返回true，wait为0时只尝试一次
+func (c *CacheLock) TryLock(lockkey string, OWNER string, expiremilseconds int, wait time.Duration) bool {
+	//必须使用redis
+	if c.Cache.UseRedisOrMemcached == 1 {
+		loggerOr(c.Logger).Error("CacheLock must use redis")
+		return false
+	}
+
+	var LOCK_TIMEOUT int32 = 10000 //msec
+	if expiremilseconds != 0 {
+		LOCK_TIMEOUT = int32(expiremilseconds)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		lock, _ := c.Cache.SetNX(lockkey, OWNER, LOCK_TIMEOUT)
+		if lock == 1 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+	}
+}
+
+// UnlockKey 释放名为lockkey的锁，只有OWNER为持有者时才会删除
+func (c *CacheLock) UnlockKey(lockkey string, OWNER string) {
 	//必须使用redis
 	if c.Cache.UseRedisOrMemcached == 1 {
-		log.Println("CacheLock must use redis!")
+		loggerOr(c.Logger).Error("CacheLock must use redis")
 		return
 	}
-	lockkey := "LOCK_" + prefix + "_" + strconv.Itoa(lockid)
-	c.Cache.DO("EVAL", LuaCheckAndDeleteDistributionLock, 1, lockkey, OWNER)
-	return
+	c.Cache.DO("EVAL", luaCheckAndDeleteDistributionLock, 1, c.Cache.Key(lockkey), OWNER)
 }
@@ -0,0 +1,65 @@
+package letsgo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// metaMagic 带元数据的缓存值首字节，元数据之后为带编码器头部的值
+// 格式：0x02 + uvarint(元数据长度) + 元数据json + 值
+const metaMagic byte = 0x02
+
+// entryMeta 缓存值的元数据
+type entryMeta struct {
+	SoftExpire int64            `json:"s,omitempty"` //软过期时间，unix毫秒，超过后GetOrLoad返回旧值并异步刷新
+	Tags       map[string]int64 `json:"t,omitempty"` //写入时各标签的版本号，与当前版本号不一致时视为未命中
+	Negative   bool             `json:"n,omitempty"` //数据不存在的标记，没有值
+}
+
+// empty 是否没有任何元数据
+func (m entryMeta) empty() bool {
+	return m.SoftExpire == 0 && len(m.Tags) == 0 && !m.Negative
+}
+
+// stale 是否已超过软过期时间
+func (m entryMeta) stale(now time.Time) bool {
+	return m.SoftExpire > 0 && now.UnixMilli() >= m.SoftExpire
+}
+
+// wrapMeta 在data前加上元数据，没有元数据时原样返回
+func wrapMeta(meta entryMeta, data []byte) ([]byte, error) {
+	if meta.empty() {
+		return data, nil
+	}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]byte, 0, 1+binary.MaxVarintLen64+len(m)+len(data))
+	wrapped = append(wrapped, metaMagic)
+	wrapped = binary.AppendUvarint(wrapped, uint64(len(m)))
+	wrapped = append(wrapped, m...)
+	return append(wrapped, data...), nil
+}
+
+// unwrapMeta 拆分元数据与值，没有元数据时返回空元数据与原值
+func unwrapMeta(data []byte) (entryMeta, []byte, error) {
+	var meta entryMeta
+	if len(data) == 0 || data[0] != metaMagic {
+		return meta, data, nil
+	}
+	n, size := binary.Uvarint(data[1:])
+	if size <= 0 || uint64(len(data)-1-size) < n {
+		return meta, nil, fmt.Errorf("invalid meta header")
+	}
+	start := 1 + size
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	if err := json.Unmarshal(data[start:start+int(n)], &meta); err != nil {
+		return meta, nil, fmt.Errorf("meta decode: %w", err)
+	}
+	return meta, data[start+int(n):], nil
+}
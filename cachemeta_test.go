@@ -0,0 +1,90 @@
+package letsgo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnwrapMeta(t *testing.T) {
+	value, err := encodeValue(JSONCodec{}, "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := entryMeta{SoftExpire: 1700000000000, Tags: map[string]int64{"user": 3}}
+	wrapped, err := wrapMeta(meta, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negative, err := wrapMeta(entryMeta{Negative: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantMeta entryMeta
+		wantData []byte
+		wantErr  bool
+	}{
+		{"no meta", value, entryMeta{}, value, false},
+		{"legacy json", []byte(`{"a":1}`), entryMeta{}, []byte(`{"a":1}`), false},
+		{"empty", nil, entryMeta{}, nil, false},
+		{"with meta", wrapped, meta, value, false},
+		{"negative", negative, entryMeta{Negative: true}, []byte{}, false},
+		{"truncated length", []byte{metaMagic}, entryMeta{}, nil, true},
+		{"length beyond data", []byte{metaMagic, 10, '{', '}'}, entryMeta{}, nil, true},
+		{"invalid meta json", append([]byte{metaMagic, 2}, "{x"...), entryMeta{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMeta, gotData, err := unwrapMeta(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unwrapMeta error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(gotMeta, tt.wantMeta) {
+				t.Fatalf("unwrapMeta meta = %+v, want %+v", gotMeta, tt.wantMeta)
+			}
+			if !bytes.Equal(gotData, tt.wantData) {
+				t.Fatalf("unwrapMeta data = %q, want %q", gotData, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestWrapMetaEmpty(t *testing.T) {
+	data := []byte{codecMagic, CodecIDJSON, '1'}
+	got, err := wrapMeta(entryMeta{}, data)
+	if err != nil {
+		t.Fatalf("wrapMeta returned %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("wrapMeta with empty meta = % x, want unchanged", got)
+	}
+}
+
+func TestEntryMetaStale(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	tests := []struct {
+		name string
+		meta entryMeta
+		want bool
+	}{
+		{"no soft expire", entryMeta{}, false},
+		{"before soft expire", entryMeta{SoftExpire: now.UnixMilli() + 1}, false},
+		{"at soft expire", entryMeta{SoftExpire: now.UnixMilli()}, true},
+		{"after soft expire", entryMeta{SoftExpire: now.UnixMilli() - 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.meta.stale(now); got != tt.want {
+				t.Fatalf("stale = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// queueIDLen 队列元素前缀ID的长度，元素为ID加编码后的值
+const queueIDLen = 32
+
+// ReliableQueueOptions 可靠队列配置
+type ReliableQueueOptions struct {
+	VisibilityTimeout time.Duration //取出后超过该时间未Ack的元素由Reap放回队列，默认30秒
+	MaxDeliveries     int64         //投递次数达到该值后Nack或超时的元素移入死信列表，为0不限制
+}
+
+// ReliableQueue 基于redis list的可靠队列，Pop将元素原子地移入消费者的处理中列表，Ack后才删除
+// 全部key使用{name}作为hash tag，redis cluster下位于同一slot
+type ReliableQueue struct {
+	Cache   *Cache
+	Name    string
+	Options ReliableQueueOptions
+	Logger  *slog.Logger
+	legacy  atomic.Bool //redis不支持BLMOVE时使用BRPOPLPUSH
+}
+
+// QueueItem 从可靠队列取出的元素
+type QueueItem struct {
+	ID         string
+	Data       []byte //编码后的值，使用Decode解码
+	Deliveries int64  //包括本次在内的投递次数
+	Consumer   string
+	raw        []byte
+	legacy     Codec
+}
+
+// Decode 将元素解码到DataStruct
+func (item *QueueItem) Decode(DataStruct interface{}) error {
+	data, err := decompressValue(item.Data)
+	if err == nil {
+		err = decodeValue(data, DataStruct, item.legacy)
+	}
+	if err != nil {
+		return fmt.Errorf("[error]Queue decode item %s: %s", item.ID, err.Error())
+	}
+	return nil
+}
+
+// QueueStats 可靠队列各列表的长度
+type QueueStats struct {
+	Ready      int64            //等待取出的元素数
+	Processing map[string]int64 //各消费者处理中的元素数
+	Dead       int64            //死信列表中的元素数
+}
+
+// NewReliableQueue 返回名为name的可靠队列，只支持redis
+func (c *Cache) NewReliableQueue(name string, opts ReliableQueueOptions) *ReliableQueue {
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	return &ReliableQueue{Cache: c, Name: name, Options: opts, Logger: c.Logger}
+}
+
+func (q *ReliableQueue) readyKey() string { return q.Cache.Key("{" + q.Name + "}:ready") }
+
+func (q *ReliableQueue) deadKey() string { return q.Cache.Key("{" + q.Name + "}:dead") }
+
+func (q *ReliableQueue) consumersKey() string { return q.Cache.Key("{" + q.Name + "}:consumers") }
+
+func (q *ReliableQueue) deadlinesKey() string { return q.Cache.Key("{" + q.Name + "}:deadlines") }
+
+func (q *ReliableQueue) deliveriesKey() string { return q.Cache.Key("{" + q.Name + "}:deliveries") }
+
+func (q *ReliableQueue) processingKey(consumer string) string {
+	return q.Cache.Key("{" + q.Name + "}:processing:" + consumer)
+}
+
+// Push 编码DataStruct并加入队列，返回元素ID
+func (q *ReliableQueue) Push(DataStruct interface{}, opts ...CacheOption) (string, error) {
+	o := newCacheOptions(opts)
+	data, err := encodeValue(q.Cache.codec(o), DataStruct)
+	if err != nil {
+		return "", fmt.Errorf("[error]Queue %s marshall struct: %s", q.Name, err.Error())
+	}
+	if data, err = q.Cache.compress(data); err != nil {
+		return "", err
+	}
+	id := genRequestID()
+	raw := append([]byte(id), data...)
+	_, err = q.do("push", func(conn redis.Conn) (interface{}, error) {
+		return conn.Do("LPUSH", q.readyKey(), raw)
+	})
+	return id, err
+}
+
+// Pop 以consumer的身份取出一个元素并移入其处理中列表，timeout内没有元素时返回nil，timeout需小于redis连接的读超时，默认1秒
+// 取出的元素需在VisibilityTimeout内Ack，否则由Reap放回队列
+func (q *ReliableQueue) Pop(consumer string, timeout time.Duration) (*QueueItem, error) {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	seconds := strconv.FormatFloat(timeout.Seconds(), 'f', 3, 64)
+	processing := q.processingKey(consumer)
+	reply, err := q.do("pop", func(conn redis.Conn) (interface{}, error) {
+		//先登记消费者，取出后崩溃时Reap也能找到其处理中列表
+		if _, err := conn.Do("SADD", q.consumersKey(), consumer); err != nil {
+			return nil, err
+		}
+		if !q.legacy.Load() {
+			raw, err := redis.Bytes(conn.Do("BLMOVE", q.readyKey(), processing, "RIGHT", "LEFT", seconds))
+			if err == nil || err == redis.ErrNil || !strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+				return raw, err
+			}
+			q.legacy.Store(true)
+		}
+		return redis.Bytes(conn.Do("BRPOPLPUSH", q.readyKey(), processing, seconds))
+	})
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw := reply.([]byte)
+	if len(raw) < queueIDLen {
+		return nil, fmt.Errorf("[error]Queue %s invalid item", q.Name)
+	}
+
+	item := &QueueItem{ID: string(raw[:queueIDLen]), Data: raw[queueIDLen:], Consumer: consumer, raw: raw, legacy: q.Cache.legacyCodec(cacheOptions{})}
+	deadline := time.Now().Add(q.Options.VisibilityTimeout).UnixMilli()
+	deliveries, err := q.do("pop", func(conn redis.Conn) (interface{}, error) {
+		if err := conn.Send("MULTI"); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("SADD", q.consumersKey(), consumer); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("HSET", q.deadlinesKey(), item.ID, deadline); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("HINCRBY", q.deliveriesKey(), item.ID, 1); err != nil {
+			return nil, err
+		}
+		replies, err := redis.Values(conn.Do("EXEC"))
+		if err != nil {
+			return nil, err
+		}
+		return redis.Int64(replies[2], nil)
+	})
+	if err != nil {
+		//元素已在处理中列表，没有截止时间时Reap会在一个VisibilityTimeout后放回队列
+		return nil, err
+	}
+	item.Deliveries = deliveries.(int64)
+	return item, nil
+}
+
+// luaQueueAck 从处理中列表删除元素并清除其截止时间与投递次数
+// 元素已被Reap放回队列或移入死信列表时不在处理中列表，此时保留截止时间与投递次数，避免清除重新投递后的状态
+// KEYS: processing deadlines deliveries  ARGV: raw id
+var luaQueueAck = redis.NewScript(3, `
+	local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+	if removed == 1 then
+		redis.call("HDEL", KEYS[2], ARGV[2])
+		redis.call("HDEL", KEYS[3], ARGV[2])
+	end
+	return removed
+`)
+
+// Ack 确认元素已处理，从处理中列表删除
+func (q *ReliableQueue) Ack(item *QueueItem) error {
+	_, err := q.do("ack", func(conn redis.Conn) (interface{}, error) {
+		return luaQueueAck.Do(conn, q.processingKey(item.Consumer), q.deadlinesKey(), q.deliveriesKey(), item.raw, item.ID)
+	})
+	return err
+}
+
+// luaQueueRequeue 将处理中的元素放回队列头部，投递次数达到上限时移入死信列表
+// ARGV[4]为1时只处理截止时间已过的元素，没有截止时间的元素设置截止时间后等待下一次
+// KEYS: processing ready dead deadlines deliveries  ARGV: raw id max checkdeadline now visibility
+// 返回 0未处理 1放回队列 2移入死信列表
+var luaQueueRequeue = redis.NewScript(5, `
+	if ARGV[4] == "1" then
+		local deadline = redis.call("HGET", KEYS[4], ARGV[2])
+		if not deadline then
+			redis.call("HSET", KEYS[4], ARGV[2], tonumber(ARGV[5]) + tonumber(ARGV[6]))
+			return 0
+		end
+		if tonumber(deadline) > tonumber(ARGV[5]) then
+			return 0
+		end
+	end
+	if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HDEL", KEYS[4], ARGV[2])
+	local deliveries = tonumber(redis.call("HGET", KEYS[5], ARGV[2]) or "0")
+	if tonumber(ARGV[3]) > 0 and deliveries >= tonumber(ARGV[3]) then
+		redis.call("HDEL", KEYS[5], ARGV[2])
+		redis.call("LPUSH", KEYS[3], ARGV[1])
+		return 2
+	end
+	redis.call("RPUSH", KEYS[2], ARGV[1])
+	return 1
+`)
+
+// Nack 处理失败，立即将元素放回队列头部，投递次数达到MaxDeliveries时移入死信列表
+func (q *ReliableQueue) Nack(item *QueueItem) error {
+	_, err := q.requeue("nack", item.Consumer, item.raw, false)
+	return err
+}
+
+// requeue 执行luaQueueRequeue
+func (q *ReliableQueue) requeue(op string, consumer string, raw []byte, checkdeadline bool) (int, error) {
+	check := "0"
+	if checkdeadline {
+		check = "1"
+	}
+	reply, err := q.do(op, func(conn redis.Conn) (interface{}, error) {
+		return redis.Int(luaQueueRequeue.Do(conn, q.processingKey(consumer), q.readyKey(), q.deadKey(), q.deadlinesKey(), q.deliveriesKey(),
+			raw, string(raw[:queueIDLen]), q.Options.MaxDeliveries, check, time.Now().UnixMilli(), q.Options.VisibilityTimeout.Milliseconds()))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int), nil
+}
+
+// Reap 检查全部消费者的处理中列表，将超过VisibilityTimeout未Ack的元素放回队列或移入死信列表
+func (q *ReliableQueue) Reap() (requeued int, dead int, err error) {
+	reply, err := q.do("reap", func(conn redis.Conn) (interface{}, error) {
+		return redis.Strings(conn.Do("SMEMBERS", q.consumersKey()))
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, consumer := range reply.([]string) {
+		items, err := q.do("reap", func(conn redis.Conn) (interface{}, error) {
+			return redis.ByteSlices(conn.Do("LRANGE", q.processingKey(consumer), 0, -1))
+		})
+		if err != nil {
+			return requeued, dead, err
+		}
+		if len(items.([][]byte)) == 0 {
+			//处理中列表为空的消费者可能已下线，移除后再次Pop时会重新加入
+			q.do("reap", func(conn redis.Conn) (interface{}, error) {
+				return conn.Do("SREM", q.consumersKey(), consumer)
+			})
+			continue
+		}
+		for _, raw := range items.([][]byte) {
+			if len(raw) < queueIDLen {
+				continue
+			}
+			result, err := q.requeue("reap", consumer, raw, true)
+			if err != nil {
+				return requeued, dead, err
+			}
+			switch result {
+			case 1:
+				requeued++
+			case 2:
+				dead++
+				loggerOr(q.Logger).Error("Queue move item to dead letter list", slog.String("queue", q.Name), slog.String("id", string(raw[:queueIDLen])))
+			}
+		}
+	}
+	return requeued, dead, nil
+}
+
+// RunReaper 每隔interval执行一次Reap，直到ctx结束
+func (q *ReliableQueue) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if requeued, dead, err := q.Reap(); err != nil {
+			loggerOr(q.Logger).Warn("Queue reap", slog.String("queue", q.Name), slog.Any("error", err))
+		} else if requeued > 0 || dead > 0 {
+			loggerOr(q.Logger).Info("Queue reap", slog.String("queue", q.Name), slog.Int("requeued", requeued), slog.Int("dead", dead))
+		}
+	}
+}
+
+// Stats 返回等待、处理中及死信元素的数量
+func (q *ReliableQueue) Stats() (QueueStats, error) {
+	stats := QueueStats{Processing: make(map[string]int64)}
+	_, err := q.do("stats", func(conn redis.Conn) (interface{}, error) {
+		var err error
+		if stats.Ready, err = redis.Int64(conn.Do("LLEN", q.readyKey())); err != nil {
+			return nil, err
+		}
+		if stats.Dead, err = redis.Int64(conn.Do("LLEN", q.deadKey())); err != nil {
+			return nil, err
+		}
+		consumers, err := redis.Strings(conn.Do("SMEMBERS", q.consumersKey()))
+		if err != nil {
+			return nil, err
+		}
+		for _, consumer := range consumers {
+			if stats.Processing[consumer], err = redis.Int64(conn.Do("LLEN", q.processingKey(consumer))); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return stats, err
+}
+
+// Len 返回等待取出的元素数
+func (q *ReliableQueue) Len() (int64, error) {
+	reply, err := q.do("len", func(conn redis.Conn) (interface{}, error) {
+		return redis.Int64(conn.Do("LLEN", q.readyKey()))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int64), nil
+}
+
+// DeadItems 返回死信列表中最多count个元素，按移入的时间倒序
+func (q *ReliableQueue) DeadItems(count int) ([]QueueItem, error) {
+	reply, err := q.do("dead", func(conn redis.Conn) (interface{}, error) {
+		return redis.ByteSlices(conn.Do("LRANGE", q.deadKey(), 0, count-1))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []QueueItem
+	for _, raw := range reply.([][]byte) {
+		if len(raw) < queueIDLen {
+			continue
+		}
+		items = append(items, QueueItem{ID: string(raw[:queueIDLen]), Data: raw[queueIDLen:], raw: raw, legacy: q.Cache.legacyCodec(cacheOptions{})})
+	}
+	return items, nil
+}
+
+// RetryDead 将死信列表中最多count个元素放回队列，返回放回的数量
+func (q *ReliableQueue) RetryDead(count int) (int, error) {
+	moved := 0
+	for ; moved < count; moved++ {
+		_, err := q.do("retry_dead", func(conn redis.Conn) (interface{}, error) {
+			return redis.Bytes(conn.Do("RPOPLPUSH", q.deadKey(), q.readyKey()))
+		})
+		if err == redis.ErrNil {
+			break
+		}
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// do 在队列所在节点的连接上执行命令并记录指标，只支持redis
+func (q *ReliableQueue) do(op string, fn func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	c := q.Cache
+	if c.UseRedisOrMemcached != 2 {
+		return nil, fmt.Errorf("[error]Queue %s: %s don't support reliable queue", q.Name, c.backend())
+	}
+	reply, err := c.doGroup([]string{q.readyKey()}, fn)
+	if err == redis.ErrNil {
+		//阻塞超时或列表为空
+		c.Metrics.ObserveCache(c.backend(), "QUEUE_"+q.Name, op, "empty")
+		return reply, err
+	}
+	if err != nil {
+		err = fmt.Errorf("[error]Queue %s %s: %s", q.Name, op, err.Error())
+	}
+	c.Metrics.ObserveCache(c.backend(), "QUEUE_"+q.Name, op, okOrError(err))
+	return reply, err
+}
@@ -0,0 +1,138 @@
+package letsgo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 默认的缓存后端名称，InitMemcached与InitRedis分别使用
+const (
+	CacheMemcached = "memcached"
+	CacheRedis     = "redis"
+)
+
+// AddCache 注册名为name的缓存后端，同名后端会被关闭并替换，第一个注册的后端同时作为默认的L.Cache
+func (L *Letsgo) AddCache(name string, cache *Cache) {
+	L.cacheLock.Lock()
+	if L.Caches == nil {
+		L.Caches = make(map[string]*Cache)
+	}
+	old := L.Caches[name]
+	cache.Name = name
+	L.Caches[name] = cache
+	if L.Cache == nil || L.Cache == old {
+		L.Cache = cache
+	}
+	L.cacheLock.Unlock()
+
+	if old != nil && old != cache {
+		old.Close()
+	}
+	L.markInit(resourceCache)
+	L.wireSubsystems()
+}
+
+// GetCache 返回名为name的缓存后端，name为空时返回默认后端，不存在时返回nil
+func (L *Letsgo) GetCache(name string) *Cache {
+	L.cacheLock.Lock()
+	defer L.cacheLock.Unlock()
+	if name == "" {
+		return L.Cache
+	}
+	return L.Caches[name]
+}
+
+// SetDefaultCache 将名为name的缓存后端设置为默认的L.Cache，DBQuery与HTTPQuery未指定后端时使用
+func (L *Letsgo) SetDefaultCache(name string) error {
+	L.cacheLock.Lock()
+	cache, ok := L.Caches[name]
+	if ok {
+		L.Cache = cache
+	}
+	L.cacheLock.Unlock()
+	if !ok {
+		return fmt.Errorf("[error]Cache unknown cache '%s'", name)
+	}
+
+	if L.DBQuery != nil {
+		L.DBQuery.SetCache(cache)
+	}
+	if L.HTTPQuery != nil {
+		L.HTTPQuery.SetCache(cache)
+	}
+	return nil
+}
+
+// CacheNames 返回已注册的缓存后端名称
+func (L *Letsgo) CacheNames() []string {
+	L.cacheLock.Lock()
+	defer L.cacheLock.Unlock()
+	names := make([]string, 0, len(L.Caches))
+	for name := range L.Caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redisCache 返回CacheLock等必须使用redis的组件所用的后端：默认后端为redis时使用默认后端，否则使用名为redis的后端或任一redis后端
+func (L *Letsgo) redisCache() *Cache {
+	L.cacheLock.Lock()
+	defer L.cacheLock.Unlock()
+	if L.Cache != nil && L.Cache.UseRedisOrMemcached == 2 {
+		return L.Cache
+	}
+	if cache, ok := L.Caches[CacheRedis]; ok && cache.UseRedisOrMemcached == 2 {
+		return cache
+	}
+	names := make([]string, 0, len(L.Caches))
+	for name := range L.Caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if L.Caches[name].UseRedisOrMemcached == 2 {
+			return L.Caches[name]
+		}
+	}
+	return L.Cache
+}
+
+// allCaches 返回全部缓存后端，包含未注册到Caches中的L.Cache
+func (L *Letsgo) allCaches() []*Cache {
+	L.cacheLock.Lock()
+	defer L.cacheLock.Unlock()
+	names := make([]string, 0, len(L.Caches))
+	for name := range L.Caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	caches := make([]*Cache, 0, len(names)+1)
+	registered := false
+	for _, name := range names {
+		caches = append(caches, L.Caches[name])
+		if L.Caches[name] == L.Cache {
+			registered = true
+		}
+	}
+	if L.Cache != nil && !registered {
+		caches = append(caches, L.Cache)
+	}
+	return caches
+}
+
+// cacheFor 按名称选择缓存后端，name为空时使用默认后端
+func cacheFor(defaultcache *Cache, caches map[string]*Cache, name string) (*Cache, error) {
+	if name == "" {
+		if defaultcache == nil {
+			return nil, fmt.Errorf("cache doesn't init")
+		}
+		return defaultcache, nil
+	}
+	cache, ok := caches[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache '%s'", name)
+	}
+	return cache, nil
+}
@@ -0,0 +1,150 @@
+package letsgo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// CacheVersioner 缓存的数据类型实现该接口时，版本号会加入缓存key，结构变更后修改版本号，旧缓存自然不再命中
+// DataStruct为slice或map时使用元素类型的版本号
+type CacheVersioner interface {
+	CacheVersion() string
+}
+
+// WithSchema 按v的类型决定缓存key的版本号，用于Delete、MDelete等没有DataStruct的调用，v可以是值或指针
+// 开启AutoSchemaVersion或使用实现CacheVersioner的类型时，Delete、MDelete必须指定
+func WithSchema(v interface{}) CacheOption {
+	return func(o *cacheOptions) {
+		o.schema = v
+	}
+}
+
+// Key 返回cachekey在远端实际使用的key，设置Namespace时加上命名空间前缀，使用DO直接操作缓存时需通过Key转换
+func (c *Cache) Key(cachekey string) string {
+	if c.Namespace == "" {
+		return cachekey
+	}
+	return c.Namespace + ":" + cachekey
+}
+
+// schemaKey 在cachekey后加上类型t的版本号，没有版本号时原样返回
+func (c *Cache) schemaKey(cachekey string, t reflect.Type) string {
+	version := c.schemaVersion(t)
+	if version == "" {
+		return cachekey
+	}
+	if !c.versioned.Load() {
+		c.versioned.Store(true)
+	}
+	return cachekey + "@" + version
+}
+
+// deleteSchemaType Delete、MDelete没有DataStruct，开启AutoSchemaVersion或已使用过带版本号的key时必须通过WithSchema指定类型
+// 否则删除的是不带版本号的key，实际缓存不会被删除
+func (c *Cache) deleteSchemaType(o cacheOptions) (reflect.Type, error) {
+	if o.schema == nil && (c.AutoSchemaVersion || c.versioned.Load()) {
+		return nil, fmt.Errorf("[error]Cache %s delete versioned cache needs WithSchema", c.backend())
+	}
+	return schemaType(nil, o), nil
+}
+
+// schemaType 决定版本号的类型，WithSchema优先，否则使用DataStruct的类型
+func schemaType(DataStruct interface{}, o cacheOptions) reflect.Type {
+	if o.schema != nil {
+		return reflect.TypeOf(o.schema)
+	}
+	return reflect.TypeOf(DataStruct)
+}
+
+// schemaVersion 类型t的版本号，实现CacheVersioner时使用其版本号，否则开启AutoSchemaVersion时使用结构指纹
+func (c *Cache) schemaVersion(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if version, ok := typeVersion(t); ok {
+		return version
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elem := t.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if version, ok := typeVersion(elem); ok {
+			return version
+		}
+	}
+	if !c.AutoSchemaVersion {
+		return ""
+	}
+	return typeFingerprint(t)
+}
+
+// typeVersion 类型t或*t实现CacheVersioner时返回其版本号
+func typeVersion(t reflect.Type) (string, bool) {
+	if v, ok := reflect.New(t).Interface().(CacheVersioner); ok {
+		return v.CacheVersion(), true
+	}
+	return "", false
+}
+
+// fingerprints 已计算的类型结构指纹
+var fingerprints sync.Map
+
+// typeFingerprint 按导出字段的名称、类型及tag计算类型的结构指纹，字段变化时指纹随之改变
+func typeFingerprint(t reflect.Type) string {
+	if fp, ok := fingerprints.Load(t); ok {
+		return fp.(string)
+	}
+	h := fnv.New32a()
+	writeTypeShape(h, t, make(map[reflect.Type]bool))
+	fp := strconv.FormatUint(uint64(h.Sum32()), 36)
+	fingerprints.Store(t, fp)
+	return fp
+}
+
+// writeTypeShape 写入类型的结构描述，seen用于结束自引用的struct
+func writeTypeShape(w io.Writer, t reflect.Type, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		io.WriteString(w, "*")
+		writeTypeShape(w, t.Elem(), seen)
+	case reflect.Slice:
+		io.WriteString(w, "[]")
+		writeTypeShape(w, t.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(w, "[%d]", t.Len())
+		writeTypeShape(w, t.Elem(), seen)
+	case reflect.Map:
+		io.WriteString(w, "map[")
+		writeTypeShape(w, t.Key(), seen)
+		io.WriteString(w, "]")
+		writeTypeShape(w, t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			io.WriteString(w, t.String())
+			return
+		}
+		seen[t] = true
+		io.WriteString(w, "struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fmt.Fprintf(w, "%s %q ", f.Name, f.Tag)
+			writeTypeShape(w, f.Type, seen)
+			io.WriteString(w, ";")
+		}
+		io.WriteString(w, "}")
+	default:
+		io.WriteString(w, t.Kind().String())
+	}
+}
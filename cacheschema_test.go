@@ -0,0 +1,127 @@
+package letsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+type schemaUserV1 struct {
+	ID   int
+	Name string
+}
+
+type schemaUserV2 struct {
+	ID   int
+	Name string
+	Age  int
+}
+
+type schemaUserTagged struct {
+	ID   int
+	Name string `json:"name"`
+}
+
+type schemaUserRetyped struct {
+	ID   int64
+	Name string
+}
+
+type schemaUserPrivate struct {
+	ID   int
+	Name string
+	note string
+}
+
+type schemaNode struct {
+	Value int
+	Next  *schemaNode
+}
+
+type schemaVersioned struct{ ID int }
+
+func (schemaVersioned) CacheVersion() string { return "v7" }
+
+func TestTypeFingerprint(t *testing.T) {
+	base := typeFingerprint(reflect.TypeOf(schemaUserV1{}))
+	tests := []struct {
+		name     string
+		typ      reflect.Type
+		wantSame bool
+	}{
+		{"same type", reflect.TypeOf(schemaUserV1{}), true},
+		{"unexported field ignored", reflect.TypeOf(schemaUserPrivate{}), true},
+		{"field added", reflect.TypeOf(schemaUserV2{}), false},
+		{"tag changed", reflect.TypeOf(schemaUserTagged{}), false},
+		{"field type changed", reflect.TypeOf(schemaUserRetyped{}), false},
+		{"slice of type", reflect.TypeOf([]schemaUserV1{}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := typeFingerprint(tt.typ)
+			if (got == base) != tt.wantSame {
+				t.Fatalf("fingerprint %s vs %s, want same = %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestTypeFingerprintSelfReference(t *testing.T) {
+	if typeFingerprint(reflect.TypeOf(schemaNode{})) == "" {
+		t.Fatal("fingerprint of self-referential struct is empty")
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	fp := typeFingerprint(reflect.TypeOf(schemaUserV1{}))
+	tests := []struct {
+		name string
+		auto bool
+		typ  reflect.Type
+		want string
+	}{
+		{"nil type", true, nil, ""},
+		{"auto off", false, reflect.TypeOf(&schemaUserV1{}), ""},
+		{"auto fingerprint through pointer", true, reflect.TypeOf(&schemaUserV1{}), fp},
+		{"versioner", false, reflect.TypeOf(&schemaVersioned{}), "v7"},
+		{"versioner wins over auto", true, reflect.TypeOf(schemaVersioned{}), "v7"},
+		{"slice of versioner", false, reflect.TypeOf(&[]*schemaVersioned{}), "v7"},
+		{"map of versioner", false, reflect.TypeOf(map[string]schemaVersioned{}), "v7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{AutoSchemaVersion: tt.auto}
+			if got := c.schemaVersion(tt.typ); got != tt.want {
+				t.Fatalf("schemaVersion = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteSchemaType(t *testing.T) {
+	tests := []struct {
+		name      string
+		auto      bool
+		versioned bool
+		opts      []CacheOption
+		want      reflect.Type
+		wantErr   bool
+	}{
+		{"unversioned cache", false, false, nil, nil, false},
+		{"auto without schema", true, false, nil, nil, true},
+		{"versioned keys without schema", false, true, nil, nil, true},
+		{"auto with schema", true, false, []CacheOption{WithSchema(schemaUserV1{})}, reflect.TypeOf(schemaUserV1{}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{AutoSchemaVersion: tt.auto}
+			c.versioned.Store(tt.versioned)
+			got, err := c.deleteSchemaType(newCacheOptions(tt.opts))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deleteSchemaType error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("deleteSchemaType = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
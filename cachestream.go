@@ -0,0 +1,252 @@
+package letsgo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// streamDataField 消息中保存编码后的值的字段
+const streamDataField = "data"
+
+// StreamMessage 从stream读取的一条消息
+type StreamMessage struct {
+	Stream     string
+	ID         string
+	Data       []byte //编码后的值，使用Decode解码
+	Deliveries int64  //已投递次数，新读取的消息为1，重新读取的pending消息为0表示未知
+	legacy     Codec
+}
+
+// Decode 将消息解码到DataStruct
+func (m *StreamMessage) Decode(DataStruct interface{}) error {
+	data, err := decompressValue(m.Data)
+	if err == nil {
+		err = decodeValue(data, DataStruct, m.legacy)
+	}
+	if err != nil {
+		return fmt.Errorf("[error]Stream decode message %s: %s", m.ID, err.Error())
+	}
+	return nil
+}
+
+// StreamPending 消费组中已投递但未确认的消息
+type StreamPending struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration //距上次投递的时间
+	Deliveries int64
+}
+
+// XAdd 编码DataStruct并追加到stream，maxlen大于0时近似裁剪到该长度，返回消息ID
+func (c *Cache) XAdd(stream string, DataStruct interface{}, maxlen int64, opts ...CacheOption) (string, error) {
+	o := newCacheOptions(opts)
+	data, err := encodeValue(c.codec(o), DataStruct)
+	if err != nil {
+		return "", fmt.Errorf("[error]Cache %s marshall struct: %s", c.backend(), err.Error())
+	}
+	if data, err = c.compress(data); err != nil {
+		return "", err
+	}
+
+	args := redis.Args{}.Add(c.Key(stream))
+	if maxlen > 0 {
+		args = args.Add("MAXLEN", "~", maxlen)
+	}
+	args = args.Add("*", streamDataField, data)
+	reply, err := c.streamDo("xadd", stream, func(conn redis.Conn) (interface{}, error) {
+		return redis.String(conn.Do("XADD", args...))
+	})
+	if err != nil {
+		return "", err
+	}
+	return reply.(string), nil
+}
+
+// XGroupCreate 创建消费组，stream不存在时自动创建，消费组已存在不视为错误
+// start为消费组的起始ID，为空时使用$只消费之后的新消息，0为从头消费
+func (c *Cache) XGroupCreate(stream string, group string, start string) error {
+	if start == "" {
+		start = "$"
+	}
+	_, err := c.streamDo("xgroup", stream, func(conn redis.Conn) (interface{}, error) {
+		reply, err := conn.Do("XGROUP", "CREATE", c.Key(stream), group, start, "MKSTREAM")
+		if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return reply, nil
+		}
+		return reply, err
+	})
+	return err
+}
+
+// XReadGroup 以消费组group中consumer的身份读取最多count条消息
+// id为>时读取从未投递的新消息，为0时读取已投递给该consumer但未确认的消息；block大于0时没有消息最多阻塞该时间，需小于redis连接的读超时
+func (c *Cache) XReadGroup(stream string, group string, consumer string, id string, count int, block time.Duration) ([]StreamMessage, error) {
+	args := redis.Args{}.Add("GROUP", group, consumer)
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+	if block > 0 {
+		args = args.Add("BLOCK", block.Milliseconds())
+	}
+	args = args.Add("STREAMS", c.Key(stream), id)
+	reply, err := c.streamDo("xreadgroup", stream, func(conn redis.Conn) (interface{}, error) {
+		streams, err := redis.Values(conn.Do("XREADGROUP", args...))
+		if err == redis.ErrNil {
+			return []interface{}(nil), nil
+		}
+		return streams, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, s := range reply.([]interface{}) {
+		pair, err := redis.Values(s, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("[error]Cache Redisc xreadgroup: unexpected reply %v", s)
+		}
+		entries, err := c.parseStreamEntries(stream, pair[1])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, entries...)
+	}
+	if id == ">" {
+		for k := range messages {
+			messages[k].Deliveries = 1
+		}
+	}
+	return messages, nil
+}
+
+// XAck 确认消息已处理，从消费组的pending列表中移除
+func (c *Cache) XAck(stream string, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := c.streamDo("xack", stream, func(conn redis.Conn) (interface{}, error) {
+		return conn.Do("XACK", redis.Args{}.Add(c.Key(stream), group).AddFlat(ids)...)
+	})
+	return err
+}
+
+// XPending 列出消费组中最多count条已投递但未确认的消息，minIdle大于0时只列出超过该时间未确认的消息
+func (c *Cache) XPending(stream string, group string, minIdle time.Duration, count int) ([]StreamPending, error) {
+	args := redis.Args{}.Add(c.Key(stream), group)
+	if minIdle > 0 {
+		args = args.Add("IDLE", minIdle.Milliseconds())
+	}
+	args = args.Add("-", "+", count)
+	reply, err := c.streamDo("xpending", stream, func(conn redis.Conn) (interface{}, error) {
+		return redis.Values(conn.Do("XPENDING", args...))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pendings []StreamPending
+	for _, row := range reply.([]interface{}) {
+		var p StreamPending
+		var idle int64
+		fields, err := redis.Values(row, nil)
+		if err == nil {
+			_, err = redis.Scan(fields, &p.ID, &p.Consumer, &idle, &p.Deliveries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[error]Cache Redisc xpending: %s", err.Error())
+		}
+		p.Idle = time.Duration(idle) * time.Millisecond
+		pendings = append(pendings, p)
+	}
+	return pendings, nil
+}
+
+// XClaim 将超过minIdle未确认的消息转给consumer并返回这些消息，已被删除的消息不会返回
+func (c *Cache) XClaim(stream string, group string, consumer string, minIdle time.Duration, ids ...string) ([]StreamMessage, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	reply, err := c.streamDo("xclaim", stream, func(conn redis.Conn) (interface{}, error) {
+		return conn.Do("XCLAIM", redis.Args{}.Add(c.Key(stream), group, consumer, minIdle.Milliseconds()).AddFlat(ids)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.parseStreamEntries(stream, reply)
+}
+
+// XTrim 将stream近似裁剪到maxlen条，返回删除的消息数
+func (c *Cache) XTrim(stream string, maxlen int64) (int64, error) {
+	reply, err := c.streamDo("xtrim", stream, func(conn redis.Conn) (interface{}, error) {
+		return redis.Int64(conn.Do("XTRIM", c.Key(stream), "MAXLEN", "~", maxlen))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int64), nil
+}
+
+// XLen 返回stream中的消息数
+func (c *Cache) XLen(stream string) (int64, error) {
+	reply, err := c.streamDo("xlen", stream, func(conn redis.Conn) (interface{}, error) {
+		return redis.Int64(conn.Do("XLEN", c.Key(stream)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int64), nil
+}
+
+// streamDo 在stream所在节点的连接上执行命令并记录指标，只支持redis
+func (c *Cache) streamDo(op string, stream string, fn func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	if c.UseRedisOrMemcached != 2 {
+		return nil, fmt.Errorf("[error]Cache %s don't support streams", c.backend())
+	}
+	reply, err := c.doGroup([]string{c.Key(stream)}, fn)
+	if err != nil {
+		err = fmt.Errorf("[error]Cache Redisc %s: %s", op, err.Error())
+	}
+	c.Metrics.ObserveCache(c.backend(), stream, op, okOrError(err))
+	return reply, err
+}
+
+// parseStreamEntries 解析XREADGROUP、XCLAIM返回的消息列表，跳过已被删除的消息
+func (c *Cache) parseStreamEntries(stream string, reply interface{}) ([]StreamMessage, error) {
+	entries, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Cache Redisc parse stream entries: %s", err.Error())
+	}
+	messages := make([]StreamMessage, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		pair, err := redis.Values(entry, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("[error]Cache Redisc parse stream entry: unexpected reply %v", entry)
+		}
+		id, err := redis.String(pair[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("[error]Cache Redisc parse stream entry id: %s", err.Error())
+		}
+		if pair[1] == nil {
+			continue
+		}
+		fields, err := redis.ByteSlices(pair[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("[error]Cache Redisc parse stream entry %s: %s", id, err.Error())
+		}
+		msg := StreamMessage{Stream: stream, ID: id, legacy: c.legacyCodec(cacheOptions{})}
+		for k := 0; k+1 < len(fields); k += 2 {
+			if string(fields[k]) == streamDataField {
+				msg.Data = fields[k+1]
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
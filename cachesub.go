@@ -0,0 +1,215 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// subscribePingInterval 订阅连接的ping间隔，超过两个间隔没有收到任何回复视为断线
+const subscribePingInterval = 30 * time.Second
+
+// PubSubMessage 订阅收到的一条消息
+type PubSubMessage struct {
+	Channel string
+	Pattern string //通过PSUBSCRIBE收到时为匹配的模式
+	Data    []byte
+}
+
+// PubSubHandler 处理一条订阅消息，在接收协程中按顺序调用，耗时的处理应自行异步
+type PubSubHandler func(ctx context.Context, msg *PubSubMessage)
+
+// Subscription 由Subscribe创建的托管订阅，断线后退避重连并重新订阅，ctx取消或Close时结束
+type Subscription struct {
+	Channels []string
+	Patterns []string
+	Logger   *slog.Logger
+	cache    *Cache
+	handler  PubSubHandler
+	onLost   func() //断线后、重连前调用，可为nil
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Subscribe 订阅channels并按模式订阅patterns，收到的消息交给handler处理，只支持redis
+// 频道名与PUB一致不加命名空间；首次订阅失败时返回错误，之后的断线在后台重连
+func (c *Cache) Subscribe(ctx context.Context, channels []string, patterns []string, handler PubSubHandler) (*Subscription, error) {
+	if c.UseRedisOrMemcached != 2 {
+		return nil, fmt.Errorf("[error]Cache %s don't support Subscribe", c.backend())
+	}
+	if len(channels) == 0 && len(patterns) == 0 || handler == nil {
+		return nil, fmt.Errorf("[error]Cache Subscribe needs channels or patterns and handler")
+	}
+	s := c.newSubscription(ctx, channels, patterns, handler)
+	psc, err := s.connect()
+	if err != nil {
+		s.cancel()
+		return nil, fmt.Errorf("[error]Cache Redis subscribe: %s", err.Error())
+	}
+	go s.run(psc)
+	return s, nil
+}
+
+// newSubscription 返回尚未连接的订阅，需调用run开始接收
+func (c *Cache) newSubscription(ctx context.Context, channels []string, patterns []string, handler PubSubHandler) *Subscription {
+	s := &Subscription{Channels: channels, Patterns: patterns, Logger: c.Logger, cache: c, handler: handler, done: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+// Close 取消订阅并等待接收协程结束
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// Done 返回在订阅结束后关闭的channel
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// connect 获取新连接并订阅全部频道与模式
+func (s *Subscription) connect() (*redis.PubSubConn, error) {
+	psc := &redis.PubSubConn{Conn: s.cache.Redis.GetConn(false)}
+	if len(s.Channels) > 0 {
+		if err := psc.Subscribe(redis.Args{}.AddFlat(s.Channels)...); err != nil {
+			psc.Close()
+			return nil, err
+		}
+	}
+	if len(s.Patterns) > 0 {
+		if err := psc.PSubscribe(redis.Args{}.AddFlat(s.Patterns)...); err != nil {
+			psc.Close()
+			return nil, err
+		}
+	}
+	return psc, nil
+}
+
+// run 从psc开始接收消息，psc为nil时先连接，ctx取消时返回
+func (s *Subscription) run(psc *redis.PubSubConn) {
+	defer close(s.done)
+	logger := loggerOr(s.Logger)
+	loop := pubSubLoop{
+		stop:     s.ctx.Done(),
+		interval: subscribePingInterval,
+		connect:  func(int) (*redis.PubSubConn, error) { return s.connect() },
+		handle: func(n redis.Message) {
+			s.handle(&PubSubMessage{Channel: n.Channel, Pattern: n.Pattern, Data: n.Data})
+		},
+		lost: func(err error, retry time.Duration) {
+			logger.Warn("Cache subscription lost, reconnecting", slog.Any("channels", s.Channels), slog.Any("patterns", s.Patterns), slog.Duration("retry_after", retry), slog.Any("error", err))
+			if s.onLost != nil {
+				s.onLost()
+			}
+		},
+	}
+	loop.run(psc)
+}
+
+// handle 调用handler，panic时记录日志后继续接收
+func (s *Subscription) handle(msg *PubSubMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(loggerOr(s.Logger), r)
+		}
+	}()
+	s.handler(s.ctx, msg)
+}
+
+// pubSubLoop 托管的订阅连接，断线后退避重连，定时ping以便及时发现断线，stop关闭时退订后返回
+// Subscription（包括一级缓存的失效广播）与sentinel事件订阅共用
+type pubSubLoop struct {
+	stop     <-chan struct{}
+	interval time.Duration                                //ping间隔，超过两个间隔没有收到任何回复视为断线
+	connect  func(attempt int) (*redis.PubSubConn, error) //获取连接并完成订阅，attempt为第几次连接
+	handle   func(n redis.Message)
+	tick     func()                               //每次ping成功后调用，可为nil
+	lost     func(err error, retry time.Duration) //断线后、等待重连前调用
+}
+
+// run 从psc开始接收，psc为nil时先连接，stop关闭时返回
+func (l *pubSubLoop) run(psc *redis.PubSubConn) {
+	backoff := 100 * time.Millisecond
+	var err error
+	for attempt := 0; ; attempt++ {
+		if psc == nil {
+			psc, err = l.connect(attempt)
+		}
+		if err == nil {
+			start := time.Now()
+			err = l.receive(psc)
+			psc = nil
+			if time.Since(start) > time.Minute {
+				backoff = 100 * time.Millisecond
+			}
+		}
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+		l.lost(err, backoff)
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
+	}
+}
+
+// receive 在一条订阅连接上处理消息，连接异常或stop关闭时返回
+func (l *pubSubLoop) receive(psc *redis.PubSubConn) error {
+	defer psc.Close()
+
+	//定时ping以便及时发现断线，stop关闭时退订以结束阻塞的Receive
+	//关闭连接前等待ping协程结束，避免并发写连接
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	finished := make(chan struct{})
+	defer close(finished)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				psc.Unsubscribe()
+				psc.PUnsubscribe()
+				return
+			case <-finished:
+				return
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+				if l.tick != nil {
+					l.tick()
+				}
+			}
+		}
+	}()
+
+	for {
+		switch n := psc.ReceiveWithTimeout(2 * l.interval).(type) {
+		case error:
+			return n
+		case redis.Message:
+			l.handle(n)
+		case redis.Subscription:
+			if n.Count == 0 {
+				return fmt.Errorf("unsubscribed")
+			}
+		}
+	}
+}
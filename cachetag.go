@@ -0,0 +1,177 @@
+package letsgo
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// tagKeyPrefix 标签版本号的缓存key前缀
+const tagKeyPrefix = "TAG_GEN_"
+
+// WithTags 写入时为缓存值加上标签，InvalidateTags使其中任一标签失效后，读取该值视为未命中
+func WithTags(tags ...string) CacheOption {
+	return func(o *cacheOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// withTagGens 写入时使用指定的标签版本号，GetOrLoad在调用loader前读取，避免加载期间发生的失效被覆盖
+func withTagGens(gens map[string]int64) CacheOption {
+	return func(o *cacheOptions) {
+		o.tagGens = gens
+	}
+}
+
+// InvalidateTags 使带有任一标签的缓存值失效
+// 每个标签在缓存中保存一个版本号，缓存值写入时记录当时的版本号，失效时递增版本号，读取时版本号不一致即视为未命中，无需扫描key
+func (c *Cache) InvalidateTags(tags ...string) error {
+	var err error
+	for _, tag := range tags {
+		tagerr := c.incrTag(tagKeyPrefix + tag)
+		c.Metrics.ObserveCache(c.backend(), tagKeyPrefix+tag, "invalidate", okOrError(tagerr))
+		if tagerr != nil {
+			loggerOr(c.Logger).Warn("Cache invalidate tag", slog.String("backend", c.backend()), slog.String("tag", tag), slog.Any("error", tagerr))
+			if err == nil {
+				err = tagerr
+			}
+		}
+	}
+	return err
+}
+
+// incrTag 递增标签版本号，不存在时以当前时间初始化
+func (c *Cache) incrTag(tagkey string) error {
+	switch c.UseRedisOrMemcached {
+	case 1:
+		if _, ok, err := c.Memcached.Increment(c.Key(tagkey), 1); ok || err != nil {
+			return err
+		}
+		added, err := c.Memcached.AddBytes(c.Key(tagkey), newTagGen(), 0)
+		if added || err != nil {
+			return err
+		}
+		//其他调用方已初始化
+		_, _, err = c.Memcached.Increment(c.Key(tagkey), 1)
+		return err
+	case 2:
+		conn := c.Redis.GetConn(true)
+		defer conn.Close()
+
+		if _, err := conn.Do("INCR", c.Key(tagkey)); err != nil {
+			return fmt.Errorf("[error]Cache Redisc incr tag: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// tagGens 读取标签的当前版本号用于写入，不存在的标签以当前时间初始化
+func (c *Cache) tagGens(tags []string) (map[string]int64, error) {
+	gens, missing, err := c.readTagGens(tags)
+	if err != nil || len(missing) == 0 {
+		return gens, err
+	}
+	for _, tag := range missing {
+		if err := c.addTag(tagKeyPrefix + tag); err != nil {
+			return nil, err
+		}
+	}
+	//重新读取，其他调用方可能已先完成初始化
+	added, missing, err := c.readTagGens(missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("[error]Cache %s tag '%s' not stored", c.backend(), missing[0])
+	}
+	for tag, gen := range added {
+		gens[tag] = gen
+	}
+	return gens, nil
+}
+
+// readTagGens 批量读取标签版本号，missing为不存在的标签
+func (c *Cache) readTagGens(tags []string) (map[string]int64, []string, error) {
+	tagkeys := make([]string, len(tags))
+	for k, tag := range tags {
+		tagkeys[k] = tagKeyPrefix + tag
+	}
+	values, err := c.mget(tagkeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	gens := make(map[string]int64, len(tags))
+	var missing []string
+	for k, tag := range tags {
+		data, ok := values[tagkeys[k]]
+		if !ok {
+			missing = append(missing, tag)
+			continue
+		}
+		gen, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[error]Cache %s invalid tag '%s': %s", c.backend(), tag, err.Error())
+		}
+		gens[tag] = gen
+	}
+	return gens, missing, nil
+}
+
+// addTag 标签不存在时写入初始版本号，标签key不过期
+func (c *Cache) addTag(tagkey string) error {
+	switch c.UseRedisOrMemcached {
+	case 1:
+		_, err := c.Memcached.AddBytes(c.Key(tagkey), newTagGen(), 0)
+		return err
+	case 2:
+		conn := c.Redis.GetConn(true)
+		defer conn.Close()
+
+		if _, err := conn.Do("SET", c.Key(tagkey), newTagGen(), "NX"); err != nil && err != redis.ErrNil {
+			return fmt.Errorf("[error]Cache Redisc add tag: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// newTagGen 标签的初始版本号，使用当前时间使标签key被淘汰后重新初始化的版本号不会与旧值相同
+func newTagGen() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+}
+
+// tagsCurrent 缓存值记录的标签版本号是否均为当前版本号，没有标签时返回true，标签不存在视为已失效
+func (c *Cache) tagsCurrent(meta entryMeta) (bool, error) {
+	if len(meta.Tags) == 0 {
+		return true, nil
+	}
+	tags := make([]string, 0, len(meta.Tags))
+	for tag := range meta.Tags {
+		tags = append(tags, tag)
+	}
+	gens, missing, err := c.readTagGens(tags)
+	if err != nil || len(missing) > 0 {
+		return false, err
+	}
+	for tag, gen := range meta.Tags {
+		if gens[tag] != gen {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// snapshotTags 使用WithTags时读取当前标签版本号并固定到opts，读取失败时由写入时再次读取
+func (c *Cache) snapshotTags(opts []CacheOption) []CacheOption {
+	o := newCacheOptions(opts)
+	if len(o.tags) == 0 || o.tagGens != nil {
+		return opts
+	}
+	gens, err := c.tagGens(o.tags)
+	if err != nil {
+		return opts
+	}
+	return append(opts[:len(opts):len(opts)], withTagGens(gens))
+}
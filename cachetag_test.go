@@ -0,0 +1,147 @@
+package letsgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// memRedis 只支持GET、MGET、SET、INCR的内存redis，用于测试不依赖redis服务的缓存逻辑
+type memRedis struct {
+	data map[string][]byte
+	lock sync.Mutex
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{data: make(map[string][]byte)}
+}
+
+func (m *memRedis) Init(serverlist []string, options []redis.DialOption) error { return nil }
+
+func (m *memRedis) GetConn(Retry bool) redis.Conn { return memConn{m} }
+
+func (m *memRedis) DoOnce(commandName string, args ...interface{}) (interface{}, error) {
+	return memConn{m}.Do(commandName, args...)
+}
+
+func (m *memRedis) Close() error { return nil }
+
+type memConn struct{ m *memRedis }
+
+func (c memConn) Close() error { return nil }
+
+func (c memConn) Err() error { return nil }
+
+func (c memConn) Send(commandName string, args ...interface{}) error {
+	return fmt.Errorf("memConn: Send not supported")
+}
+
+func (c memConn) Flush() error { return nil }
+
+func (c memConn) Receive() (interface{}, error) {
+	return nil, fmt.Errorf("memConn: Receive not supported")
+}
+
+func (c memConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	m := c.m
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := func(k int) string { return fmt.Sprint(args[k]) }
+	switch strings.ToUpper(commandName) {
+	case "GET":
+		if v, ok := m.data[key(0)]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "MGET":
+		replies := make([]interface{}, len(args))
+		for k := range args {
+			if v, ok := m.data[key(k)]; ok {
+				replies[k] = v
+			}
+		}
+		return replies, nil
+	case "SET":
+		if len(args) > 2 && strings.ToUpper(fmt.Sprint(args[2])) == "NX" {
+			if _, ok := m.data[key(0)]; ok {
+				return nil, nil
+			}
+		}
+		value, err := redis.Bytes(args[1], nil)
+		if err != nil {
+			value = []byte(fmt.Sprint(args[1]))
+		}
+		m.data[key(0)] = value
+		return "OK", nil
+	case "INCR":
+		n, _ := strconv.ParseInt(string(m.data[key(0)]), 10, 64)
+		n++
+		m.data[key(0)] = []byte(strconv.FormatInt(n, 10))
+		return n, nil
+	}
+	return nil, fmt.Errorf("memConn: unsupported command %s", commandName)
+}
+
+func TestTagsCurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(c *Cache) entryMeta
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:  "no tags",
+			setup: func(c *Cache) entryMeta { return entryMeta{} },
+			want:  true,
+		},
+		{
+			name: "current generation",
+			setup: func(c *Cache) entryMeta {
+				gens, _ := c.tagGens([]string{"user", "item"})
+				return entryMeta{Tags: gens}
+			},
+			want: true,
+		},
+		{
+			name: "invalidated tag",
+			setup: func(c *Cache) entryMeta {
+				gens, _ := c.tagGens([]string{"user", "item"})
+				c.InvalidateTags("item")
+				return entryMeta{Tags: gens}
+			},
+			want: false,
+		},
+		{
+			name: "missing tag key",
+			setup: func(c *Cache) entryMeta {
+				return entryMeta{Tags: map[string]int64{"evicted": 1}}
+			},
+			want: false,
+		},
+		{
+			name: "invalid tag value",
+			setup: func(c *Cache) entryMeta {
+				c.Redis.DoOnce("SET", c.Key(tagKeyPrefix+"broken"), "x")
+				return entryMeta{Tags: map[string]int64{"broken": 1}}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{UseRedisOrMemcached: 2, Redis: newMemRedis(), Namespace: "test"}
+			meta := tt.setup(c)
+			got, err := c.tagsCurrent(meta)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tagsCurrent error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("tagsCurrent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
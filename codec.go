@@ -0,0 +1,210 @@
+package letsgo
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// 内置编码器的ID，写入缓存值的头部，已写入的值依赖这些ID解码，不可修改
+const (
+	CodecIDJSON     byte = 1
+	CodecIDGob      byte = 2
+	CodecIDMsgpack  byte = 3
+	CodecIDProtobuf byte = 4
+)
+
+// codecMagic 带编码器头部的缓存值首字节
+// 旧版本写入的json值以可见字符开头，gob值以非0长度开头，均不会以0开头，因此可与新格式区分
+const codecMagic byte = 0x00
+
+// Codec 缓存值编码器，Cache.Get/Set通过其序列化数据，ID会写入缓存值头部以便读取时选择对应的编码器
+type Codec interface {
+	ID() byte
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec 使用jsoniter编码，与标准库encoding/json兼容
+type JSONCodec struct{}
+
+// ID 编码器ID
+func (JSONCodec) ID() byte { return CodecIDJSON }
+
+// Name 编码器名称
+func (JSONCodec) Name() string { return "json" }
+
+// Marshal 编码
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	return json.Marshal(v)
+}
+
+// Unmarshal 解码
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec 使用encoding/gob编码，接口类型的值需先gob.Register
+type GobCodec struct{}
+
+// ID 编码器ID
+func (GobCodec) ID() byte { return CodecIDGob }
+
+// Name 编码器名称
+func (GobCodec) Name() string { return "gob" }
+
+// Marshal 编码
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 解码
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec 使用msgpack编码，体积小于json，time.Time解码后为本地时区
+type MsgpackCodec struct{}
+
+// ID 编码器ID
+func (MsgpackCodec) ID() byte { return CodecIDMsgpack }
+
+// Name 编码器名称
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+// Marshal 编码
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal 解码
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// ProtobufCodec 使用protobuf编码，值必须实现proto.Message
+type ProtobufCodec struct{}
+
+// ID 编码器ID
+func (ProtobufCodec) ID() byte { return CodecIDProtobuf }
+
+// Name 编码器名称
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+// Marshal 编码
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal 解码
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// codecRegistry 按ID与名称登记的编码器
+var codecRegistry = struct {
+	byID   map[byte]Codec
+	byName map[string]Codec
+	lock   sync.RWMutex
+}{
+	byID: map[byte]Codec{
+		CodecIDJSON:     JSONCodec{},
+		CodecIDGob:      GobCodec{},
+		CodecIDMsgpack:  MsgpackCodec{},
+		CodecIDProtobuf: ProtobufCodec{},
+	},
+	byName: map[string]Codec{
+		"json":     JSONCodec{},
+		"gob":      GobCodec{},
+		"msgpack":  MsgpackCodec{},
+		"protobuf": ProtobufCodec{},
+	},
+}
+
+// RegisterCodec 登记自定义编码器，ID不可与已登记的编码器重复，0保留
+func RegisterCodec(codec Codec) error {
+	codecRegistry.lock.Lock()
+	defer codecRegistry.lock.Unlock()
+	if codec.ID() == 0 {
+		return fmt.Errorf("[error]Codec id 0 is reserved")
+	}
+	if old, ok := codecRegistry.byID[codec.ID()]; ok {
+		return fmt.Errorf("[error]Codec id %d already registered by '%s'", codec.ID(), old.Name())
+	}
+	codecRegistry.byID[codec.ID()] = codec
+	codecRegistry.byName[strings.ToLower(codec.Name())] = codec
+	return nil
+}
+
+// CodecByName 按名称返回已登记的编码器，如json、gob、msgpack、protobuf
+func CodecByName(name string) (Codec, error) {
+	codecRegistry.lock.RLock()
+	defer codecRegistry.lock.RUnlock()
+	codec, ok := codecRegistry.byName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("[error]Codec unknown codec '%s'", name)
+	}
+	return codec, nil
+}
+
+// codecByID 按ID返回已登记的编码器
+func codecByID(id byte) (Codec, bool) {
+	codecRegistry.lock.RLock()
+	defer codecRegistry.lock.RUnlock()
+	codec, ok := codecRegistry.byID[id]
+	return codec, ok
+}
+
+// encodeValue 使用codec编码v并加上编码器头部
+func encodeValue(codec Codec, v interface{}) ([]byte, error) {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s encode: %w", codec.Name(), err)
+	}
+	data := make([]byte, 0, len(payload)+2)
+	data = append(data, codecMagic, codec.ID())
+	return append(data, payload...), nil
+}
+
+// decodeValue 按头部中的编码器ID解码data，没有头部的旧值使用legacy解码，元数据会被跳过
+func decodeValue(data []byte, v interface{}, legacy Codec) error {
+	_, data, err := unwrapMeta(data)
+	if err != nil {
+		return err
+	}
+	if len(data) >= 2 && data[0] == codecMagic {
+		codec, ok := codecByID(data[1])
+		if !ok {
+			return fmt.Errorf("unknown codec id %d", data[1])
+		}
+		if err := codec.Unmarshal(data[2:], v); err != nil {
+			return fmt.Errorf("%s decode: %w", codec.Name(), err)
+		}
+		return nil
+	}
+	if err := legacy.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s decode: %w", legacy.Name(), err)
+	}
+	return nil
+}
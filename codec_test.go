@@ -0,0 +1,109 @@
+package letsgo
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+type codecTestValue struct {
+	Name  string
+	Count int
+}
+
+func TestEncodeValueWritesHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSONCodec{}},
+		{"gob", GobCodec{}},
+		{"msgpack", MsgpackCodec{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeValue(tt.codec, &codecTestValue{Name: "a", Count: 3})
+			if err != nil {
+				t.Fatalf("encodeValue returned %v", err)
+			}
+			if len(data) < 2 || data[0] != codecMagic || data[1] != tt.codec.ID() {
+				t.Fatalf("header = % x, want %02x %02x", data[:2], codecMagic, tt.codec.ID())
+			}
+
+			//legacy编码器与写入时不同，头部决定实际使用的编码器
+			var got codecTestValue
+			if err := decodeValue(data, &got, JSONCodec{}); err != nil {
+				t.Fatalf("decodeValue returned %v", err)
+			}
+			if got != (codecTestValue{Name: "a", Count: 3}) {
+				t.Fatalf("decodeValue = %+v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeValueLegacy(t *testing.T) {
+	var gobdata bytes.Buffer
+	if err := gob.NewEncoder(&gobdata).Encode(&codecTestValue{Name: "g", Count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	withmeta, err := wrapMeta(entryMeta{SoftExpire: 1}, []byte(`{"Name":"m","Count":4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		legacy  Codec
+		want    codecTestValue
+		wantErr bool
+	}{
+		{"legacy json", []byte(`{"Name":"j","Count":1}`), JSONCodec{}, codecTestValue{Name: "j", Count: 1}, false},
+		{"legacy gob", gobdata.Bytes(), GobCodec{}, codecTestValue{Name: "g", Count: 2}, false},
+		{"legacy json behind meta", withmeta, JSONCodec{}, codecTestValue{Name: "m", Count: 4}, false},
+		{"legacy gob with json codec", gobdata.Bytes(), JSONCodec{}, codecTestValue{}, true},
+		{"unknown codec id", []byte{codecMagic, 0xfe, '{', '}'}, JSONCodec{}, codecTestValue{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got codecTestValue
+			err := decodeValue(tt.data, &got, tt.legacy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("decodeValue = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   Codec
+		wantErr bool
+	}{
+		{"reserved id", testCodec{id: 0, name: "zero"}, true},
+		{"duplicate id", testCodec{id: CodecIDJSON, name: "json2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterCodec(tt.codec); (err != nil) != tt.wantErr {
+				t.Fatalf("RegisterCodec error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testCodec 只用于测试登记的编码器
+type testCodec struct {
+	JSONCodec
+	id   byte
+	name string
+}
+
+func (c testCodec) ID() byte { return c.id }
+
+func (c testCodec) Name() string { return c.name }
@@ -0,0 +1,193 @@
+package letsgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 内置压缩算法的ID，写入缓存值的头部，已写入的值依赖这些ID解压，不可修改
+const (
+	CompressIDGzip   byte = 1
+	CompressIDZstd   byte = 2
+	CompressIDSnappy byte = 3
+)
+
+// compressMagic 压缩后的缓存值首字节，与codecMagic及旧版本的json、gob值均不冲突
+const compressMagic byte = 0x01
+
+// defaultCompressThreshold 默认压缩阈值，编码后超过该字节数才压缩
+const defaultCompressThreshold = 4096
+
+// Compressor 缓存值压缩算法，ID会写入缓存值头部以便读取时选择对应的算法
+type Compressor interface {
+	ID() byte
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// CompressOptions 缓存值压缩配置
+type CompressOptions struct {
+	Compressor Compressor //压缩算法
+	Threshold  int        //编码后超过该字节数才压缩，默认4096
+}
+
+// GzipCompressor gzip压缩
+type GzipCompressor struct{}
+
+// ID 算法ID
+func (GzipCompressor) ID() byte { return CompressIDGzip }
+
+// Name 算法名称
+func (GzipCompressor) Name() string { return "gzip" }
+
+// Compress 压缩
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress 解压
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zstd的编码器与解码器可并发使用，全部ZstdCompressor共享
+var (
+	zstdEncoder  *zstd.Encoder
+	zstdDecoder  *zstd.Decoder
+	zstdInitErr  error
+	zstdInitOnce sync.Once
+)
+
+func zstdInit() error {
+	zstdInitOnce.Do(func() {
+		if zstdEncoder, zstdInitErr = zstd.NewWriter(nil); zstdInitErr != nil {
+			return
+		}
+		zstdDecoder, zstdInitErr = zstd.NewReader(nil)
+	})
+	return zstdInitErr
+}
+
+// ZstdCompressor zstd压缩
+type ZstdCompressor struct{}
+
+// ID 算法ID
+func (ZstdCompressor) ID() byte { return CompressIDZstd }
+
+// Name 算法名称
+func (ZstdCompressor) Name() string { return "zstd" }
+
+// Compress 压缩
+func (ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+// Decompress 解压
+func (ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := zstdInit(); err != nil {
+		return nil, err
+	}
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+// SnappyCompressor snappy压缩，压缩率低于gzip与zstd但速度最快
+type SnappyCompressor struct{}
+
+// ID 算法ID
+func (SnappyCompressor) ID() byte { return CompressIDSnappy }
+
+// Name 算法名称
+func (SnappyCompressor) Name() string { return "snappy" }
+
+// Compress 压缩
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress 解压
+func (SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// compressors 按ID登记的内置压缩算法
+var compressors = map[byte]Compressor{
+	CompressIDGzip:   GzipCompressor{},
+	CompressIDZstd:   ZstdCompressor{},
+	CompressIDSnappy: SnappyCompressor{},
+}
+
+// CompressorByName 按名称返回内置压缩算法 gzip zstd snappy
+func CompressorByName(name string) (Compressor, error) {
+	for _, compressor := range compressors {
+		if compressor.Name() == strings.ToLower(name) {
+			return compressor, nil
+		}
+	}
+	return nil, fmt.Errorf("[error]Compressor unknown compressor '%s'", name)
+}
+
+// compressValue 超过阈值时压缩data并加上压缩头部，压缩后不更小时返回原值
+// ratio为压缩后与压缩前的大小之比，未尝试压缩时为0
+func compressValue(opts *CompressOptions, data []byte) ([]byte, float64, error) {
+	if opts == nil || opts.Compressor == nil {
+		return data, 0, nil
+	}
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = defaultCompressThreshold
+	}
+	if len(data) < threshold {
+		return data, 0, nil
+	}
+	payload, err := opts.Compressor.Compress(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s compress: %w", opts.Compressor.Name(), err)
+	}
+	ratio := float64(len(payload)+2) / float64(len(data))
+	if ratio >= 1 {
+		return data, ratio, nil
+	}
+	compressed := make([]byte, 0, len(payload)+2)
+	compressed = append(compressed, compressMagic, opts.Compressor.ID())
+	return append(compressed, payload...), ratio, nil
+}
+
+// decompressValue 按压缩头部解压data，未压缩的值原样返回
+func decompressValue(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != compressMagic {
+		return data, nil
+	}
+	compressor, ok := compressors[data[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown compressor id %d", data[1])
+	}
+	value, err := compressor.Decompress(data[2:])
+	if err != nil {
+		return nil, fmt.Errorf("%s decompress: %w", compressor.Name(), err)
+	}
+	return value, nil
+}
@@ -0,0 +1,80 @@
+package letsgo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressValue(t *testing.T) {
+	large := []byte(strings.Repeat("letsgo", 1000))
+	small := []byte("letsgo")
+
+	tests := []struct {
+		name           string
+		opts           *CompressOptions
+		data           []byte
+		wantCompressed bool
+	}{
+		{"no options", nil, large, false},
+		{"below default threshold", &CompressOptions{Compressor: GzipCompressor{}}, small, false},
+		{"below custom threshold", &CompressOptions{Compressor: GzipCompressor{}, Threshold: len(large) + 1}, large, false},
+		{"gzip", &CompressOptions{Compressor: GzipCompressor{}}, large, true},
+		{"zstd", &CompressOptions{Compressor: ZstdCompressor{}, Threshold: 1}, large, true},
+		{"snappy", &CompressOptions{Compressor: SnappyCompressor{}, Threshold: 1}, large, true},
+		{"not smaller", &CompressOptions{Compressor: GzipCompressor{}, Threshold: 1}, small, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := compressValue(tt.opts, tt.data)
+			if err != nil {
+				t.Fatalf("compressValue returned %v", err)
+			}
+			compressed := len(data) >= 2 && data[0] == compressMagic
+			if compressed != tt.wantCompressed {
+				t.Fatalf("compressed = %v, want %v", compressed, tt.wantCompressed)
+			}
+			if compressed && data[1] != tt.opts.Compressor.ID() {
+				t.Fatalf("compressor id = %d, want %d", data[1], tt.opts.Compressor.ID())
+			}
+
+			got, err := decompressValue(data)
+			if err != nil {
+				t.Fatalf("decompressValue returned %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatalf("decompressValue did not restore the original value")
+			}
+		})
+	}
+}
+
+func TestDecompressValueUncompressed(t *testing.T) {
+	encoded, err := encodeValue(JSONCodec{}, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"codec header", encoded, false},
+		{"legacy json", []byte(`{"a":1}`), false},
+		{"unknown compressor id", []byte{compressMagic, 0xfe, 1, 2}, true},
+		{"corrupt gzip", []byte{compressMagic, CompressIDGzip, 1, 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompressValue(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decompressValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.data) {
+				t.Fatalf("decompressValue changed an uncompressed value")
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"time"
+)
+
+// Duration 支持"3s"、"500ms"这类写法的时长，用于声明式配置文件
+type Duration time.Duration
+
+// UnmarshalText 解析时长字符串，json/yaml/toml均会调用此方法
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText 输出时长字符串
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Std 转换为time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// BootConfig 声明式启动配置结构体，对应letsgo.InitFromFile读取的配置文件
+// 未出现的段落对应的组件不会被初始化
+type BootConfig struct {
+	Log          *LogBootConfig             `json:"log" yaml:"log" toml:"log"`
+	MemConfig    bool                       `json:"mem_config" yaml:"mem_config" toml:"mem_config"`
+	ContextSet   bool                       `json:"context_set" yaml:"context_set" toml:"context_set"`
+	Schedule     bool                       `json:"schedule" yaml:"schedule" toml:"schedule"`
+	Cache        *CacheBootConfig           `json:"cache" yaml:"cache" toml:"cache"`
+	CacheLock    bool                       `json:"cache_lock" yaml:"cache_lock" toml:"cache_lock"`
+	DB           DBconfigStruct             `json:"db" yaml:"db" toml:"db"`
+	HTTPQuery    *HTTPQueryBootConfig       `json:"http_query" yaml:"http_query" toml:"http_query"`
+	Microservice *MicroserviceBootConfig    `json:"microservice" yaml:"microservice" toml:"microservice"`
+	RPC          map[string]RPCconfig       `json:"rpc" yaml:"rpc" toml:"rpc"`
+	SSE          *SSEBootConfig             `json:"sse" yaml:"sse" toml:"sse"`
+	Server       *ServerBootConfig          `json:"server" yaml:"server" toml:"server"`
+	Retry        map[string]RetryBootConfig `json:"retry" yaml:"retry" toml:"retry"` //key为依赖名称 log db redis等
+}
+
+// LogBootConfig 日志配置
+type LogBootConfig struct {
+	File      string            `json:"file" yaml:"file" toml:"file"`                   //日志文件路径，为空输出到标准错误
+	Level     string            `json:"level" yaml:"level" toml:"level"`                //日志级别 debug info warn error
+	Format    string            `json:"format" yaml:"format" toml:"format"`             //输出格式 json或text
+	AddSource bool              `json:"add_source" yaml:"add_source" toml:"add_source"` //是否记录调用位置
+	Rotate    *RotateBootConfig `json:"rotate" yaml:"rotate" toml:"rotate"`             //日志切割配置，同时用于http请求响应日志
+}
+
+// RotateBootConfig 日志切割与保留配置
+type RotateBootConfig struct {
+	MaxSizeMB  int      `json:"max_size_mb" yaml:"max_size_mb" toml:"max_size_mb"` //单个文件最大MB
+	Interval   Duration `json:"interval" yaml:"interval" toml:"interval"`          //按时间切割的周期，如24h
+	MaxBackups int      `json:"max_backups" yaml:"max_backups" toml:"max_backups"` //最多保留的备份数
+	MaxAge     Duration `json:"max_age" yaml:"max_age" toml:"max_age"`             //备份最长保留时间，如168h
+	Compress   bool     `json:"compress" yaml:"compress" toml:"compress"`          //是否gzip压缩备份
+}
+
+// ServerBootConfig Serve使用的服务端配置
+type ServerBootConfig struct {
+	ServiceName string   `json:"service_name" yaml:"service_name" toml:"service_name"` //微服务注册名称，为空不注册
+	BodyLimit   string   `json:"body_limit" yaml:"body_limit" toml:"body_limit"`       //请求体大小限制，如4M
+	Timeout     Duration `json:"timeout" yaml:"timeout" toml:"timeout"`                //单个请求处理超时
+	AccessLog   bool     `json:"access_log" yaml:"access_log" toml:"access_log"`       //是否记录访问日志
+	TLSCertFile string   `json:"tls_cert_file" yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile  string   `json:"tls_key_file" yaml:"tls_key_file" toml:"tls_key_file"`
+}
+
+// CacheBootConfig 缓存配置，memcached与redis可同时配置，分别注册为名为memcached和redis的后端
+type CacheBootConfig struct {
+	Memcached     *MemcachedBootConfig              `json:"memcached" yaml:"memcached" toml:"memcached"`
+	Redis         *RedisBootConfig                  `json:"redis" yaml:"redis" toml:"redis"`
+	Local         *LocalCacheBootConfig             `json:"local" yaml:"local" toml:"local"`                            //进程内一级缓存，为空不启用，作用于默认后端
+	Backends      map[string]CacheBackendBootConfig `json:"backends" yaml:"backends" toml:"backends"`                   //其他按名称注册的缓存后端
+	Default       string                            `json:"default" yaml:"default" toml:"default"`                      //默认后端名称，为空时redis优先，其次memcached
+	Codec         string                            `json:"codec" yaml:"codec" toml:"codec"`                            //memcached与redis使用的编码器 json gob msgpack protobuf，为空使用json
+	Compress      *CompressBootConfig               `json:"compress" yaml:"compress" toml:"compress"`                   //memcached与redis的压缩配置，为空不压缩
+	Namespace     string                            `json:"namespace" yaml:"namespace" toml:"namespace"`                //全部后端远端key的命名空间前缀，backends中未设置时使用该值
+	SchemaVersion bool                              `json:"schema_version" yaml:"schema_version" toml:"schema_version"` //全部后端按数据类型的结构指纹为key加上版本
+}
+
+// CacheBackendBootConfig 单个命名缓存后端配置，memcached与redis二选一
+type CacheBackendBootConfig struct {
+	Memcached     *MemcachedBootConfig  `json:"memcached" yaml:"memcached" toml:"memcached"`
+	Redis         *RedisBootConfig      `json:"redis" yaml:"redis" toml:"redis"`
+	Local         *LocalCacheBootConfig `json:"local" yaml:"local" toml:"local"`                            //进程内一级缓存，为空不启用
+	Codec         string                `json:"codec" yaml:"codec" toml:"codec"`                            //编码器 json gob msgpack protobuf，为空使用json
+	Compress      *CompressBootConfig   `json:"compress" yaml:"compress" toml:"compress"`                   //压缩配置，为空不压缩
+	Namespace     string                `json:"namespace" yaml:"namespace" toml:"namespace"`                //远端key的命名空间前缀
+	SchemaVersion bool                  `json:"schema_version" yaml:"schema_version" toml:"schema_version"` //按数据类型的结构指纹为key加上版本
+}
+
+// CompressBootConfig 缓存值压缩配置
+type CompressBootConfig struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm" toml:"algorithm"` //gzip zstd snappy
+	Threshold int    `json:"threshold" yaml:"threshold" toml:"threshold"` //编码后超过该字节数才压缩，默认4096
+}
+
+// LocalCacheBootConfig 进程内一级缓存配置
+type LocalCacheBootConfig struct {
+	MaxEntries        int      `json:"max_entries" yaml:"max_entries" toml:"max_entries"`
+	TTL               Duration `json:"ttl" yaml:"ttl" toml:"ttl"`
+	Prefixes          []string `json:"prefixes" yaml:"prefixes" toml:"prefixes"`
+	InvalidateChannel string   `json:"invalidate_channel" yaml:"invalidate_channel" toml:"invalidate_channel"`
+}
+
+// MemcachedBootConfig memcached配置
+type MemcachedBootConfig struct {
+	Hosts        []string `json:"hosts" yaml:"hosts" toml:"hosts"`
+	MaxIdleConns int      `json:"max_idle_conns" yaml:"max_idle_conns" toml:"max_idle_conns"`
+	Timeout      Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// RedisBootConfig redis配置
+type RedisBootConfig struct {
+	Type             int      `json:"type" yaml:"type" toml:"type"`          //1-standalone 2-redis cluster 3-sentinel
+	Servers          []string `json:"servers" yaml:"servers" toml:"servers"` //sentinel模式下第一个为主节点名称，其余为sentinel地址
+	Password         string   `json:"password" yaml:"password" toml:"password"`
+	DB               int      `json:"db" yaml:"db" toml:"db"`
+	ConnectTimeout   Duration `json:"connect_timeout" yaml:"connect_timeout" toml:"connect_timeout"`
+	ReadTimeout      Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout     Duration `json:"write_timeout" yaml:"write_timeout" toml:"write_timeout"`
+	SentinelPassword string   `json:"sentinel_password" yaml:"sentinel_password" toml:"sentinel_password"`    //sentinel开启认证时的密码
+	ReadFromReplicas bool     `json:"read_from_replicas" yaml:"read_from_replicas" toml:"read_from_replicas"` //sentinel模式下只读命令发往从节点
+}
+
+// HTTPQueryBootConfig HTTPQuery配置
+type HTTPQueryBootConfig struct {
+	Log string `json:"log" yaml:"log" toml:"log"` //http请求响应日志文件，为空不记录
+}
+
+// MicroserviceBootConfig 微服务客户端配置
+type MicroserviceBootConfig struct {
+	Type                 string `json:"type" yaml:"type" toml:"type"` //目前仅支持consul
+	DeregisterBeforeExit bool   `json:"deregister_before_exit" yaml:"deregister_before_exit" toml:"deregister_before_exit"`
+}
+
+// SSEBootConfig http sse服务端配置
+type SSEBootConfig struct {
+	Enable bool `json:"enable" yaml:"enable" toml:"enable"`
+}
+
+// RetryBootConfig 启动依赖重试策略配置
+type RetryBootConfig struct {
+	MaxAttempts    int      `json:"max_attempts" yaml:"max_attempts" toml:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff" toml:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff" toml:"max_backoff"`
+	Multiplier     float64  `json:"multiplier" yaml:"multiplier" toml:"multiplier"`
+}
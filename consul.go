@@ -2,7 +2,7 @@ package letsgo
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"sync"
@@ -17,6 +17,7 @@ type ConsulClient struct {
 	ServiceID []string
 	DExit     bool
 	Lock      sync.Mutex
+	Logger    *slog.Logger
 }
 
 //NewConsulClient 返回一个ConsulClient结构体指针
@@ -30,7 +31,7 @@ func (c *ConsulClient) Init() error {
 
 	client, err := consulapi.NewClient(config)
 	if err != nil {
-		log.Println("[error]ConsulClient init error : ", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient init", slog.Any("error", err))
 		return err
 	}
 
@@ -78,7 +79,7 @@ func SeqGetInterfaceIP(name ...string) string {
 func (c *ConsulClient) RegisterService(service_name string, service_port int) error {
 	hostname, err := os.Hostname() //使用hostname作为serviceid
 	if err != nil {
-		log.Println("[error]ConsulClient RegisterService get os.Hostname error:", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient RegisterService get os.Hostname", slog.Any("error", err))
 		return err
 	}
 
@@ -102,7 +103,7 @@ func (c *ConsulClient) RegisterService(service_name string, service_port int) er
 
 	err = c.Client.Agent().ServiceRegister(registration)
 	if err != nil {
-		log.Println("[error]ConsulClient RegisterService register server error : ", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient RegisterService register server", slog.Any("error", err))
 		return err
 	}
 	c.Lock.Lock()
@@ -115,13 +116,13 @@ func (c *ConsulClient) RegisterService(service_name string, service_port int) er
 func (c *ConsulClient) DeregisterService(service_name string) error {
 	hostname, err := os.Hostname()
 	if err != nil {
-		log.Println("[error]ConsulClient DeregisterService get os.Hostname error:", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient DeregisterService get os.Hostname", slog.Any("error", err))
 		return err
 	}
 
 	err = c.Client.Agent().ServiceDeregister(service_name + ":" + hostname)
 	if err != nil {
-		log.Println("[error]ConsulClient DeregisterService deregister service error : ", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient DeregisterService deregister service", slog.Any("error", err))
 		return err
 	}
 	return nil
@@ -132,7 +133,7 @@ func (c *ConsulClient) DeregisterAllService() error {
 	for _, id := range c.ServiceID {
 		err := c.Client.Agent().ServiceDeregister(id)
 		if err != nil {
-			log.Println("[error]ConsulClient DeregisterAllService deregister service error : ", err.Error())
+			loggerOr(c.Logger).Error("ConsulClient DeregisterAllService deregister service", slog.Any("error", err))
 			return err
 		}
 	}
@@ -143,7 +144,7 @@ func (c *ConsulClient) DeregisterAllService() error {
 func (c *ConsulClient) ServiceDiscovery(service_name string) (string, error) {
 	services, _, err := c.Client.Health().Service(service_name, "", true, nil)
 	if err != nil {
-		log.Println("[error]ConsulClient ServiceDiscovery get service error : ", err.Error())
+		loggerOr(c.Logger).Error("ConsulClient ServiceDiscovery get service", slog.Any("error", err))
 		return "", err
 	}
 
@@ -153,6 +154,15 @@ func (c *ConsulClient) ServiceDiscovery(service_name string) (string, error) {
 	return fmt.Sprint(services[index].Service.Address, ":", services[index].Service.Port), nil
 }
 
+//Ping 检查consul集群是否可用
+func (c *ConsulClient) Ping() error {
+	if c.Client == nil {
+		return fmt.Errorf("[error]ConsulClient not init")
+	}
+	_, err := c.Client.Status().Leader()
+	return err
+}
+
 //微服务客户端是否活跃
 func (c *ConsulClient) IsActive() bool {
 	return c.Active
@@ -2,14 +2,19 @@ package letsgo
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/gob"
 	"fmt"
+	"log/slog"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql" //mysql
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DBQueryer 接口描述
@@ -34,11 +39,16 @@ type DBC map[string]DBSet
 // DBQuery 结构体
 type DBQuery struct {
 	DBset          DBC
-	Cache          *Cache
+	Cache          *Cache            //默认缓存后端
+	Caches         map[string]*Cache //按名称选择的缓存后端，见DBQueryBuilder.SetCacheName
+	CacheLock      *CacheLock        //DBQueryBuilder.SetLoadLock启用时用于跨实例合并加载
 	SQLcounter     int
 	SQLcounterLock sync.Mutex
 	RWflag         int
 	RWflagLock     sync.Mutex
+	Metrics        *Metrics
+	Tracer         trace.Tracer
+	Logger         *slog.Logger
 }
 
 // newDBQuery 返回一个DBQuery结构体指针
@@ -70,14 +80,23 @@ func (c *DBQuery) SubCounter() {
 	c.SQLcounter--
 }
 
+// GetCounter 读取内置计数器，即在途数量
+func (c *DBQuery) GetCounter() int {
+	c.SQLcounterLock.Lock()
+	defer c.SQLcounterLock.Unlock()
+	return c.SQLcounter
+}
+
 // SelectOne 单条查询方法
-func (c *DBQuery) SelectOne(cqer DBQueryer) (bool, error) {
+func (c *DBQuery) SelectOne(cqer DBQueryer) (isget bool, err error) {
 	c.AddCounter()
 	defer c.SubCounter()
 
 	DB := cqer.GetBuilder()
 	SQL := DB.SQL
 	SQLcondition := DB.SQLcondition
+	ctx, span := startSpan(c.Tracer, DB.CommonParams.GetContext(), "db.select_one", trace.WithAttributes(attribute.String("db.name", cqer.GetDbname()), attribute.String("db.statement", SQL)))
+	defer func() { c.finish(span, "select_one", cqer.GetDbname(), SQL, err) }()
 	Result := DB.Result
 	CacheKey := cqer.GetCacheKey()
 	CacheExpire := cqer.GetCacheExpire()
@@ -85,6 +104,13 @@ func (c *DBQuery) SelectOne(cqer DBQueryer) (bool, error) {
 	DbName := cqer.GetDbname()
 	UseCache := cqer.IsUseCache()
 
+	var cache *Cache
+	if UseCache == true {
+		if cache, err = cacheFor(c.Cache, c.Caches, DB.CacheName); err != nil {
+			return false, fmt.Errorf("[error]CacheQuery select cache: %w", err)
+		}
+	}
+
 	//Result Must Be A ptr to slice
 	if reflect.TypeOf(Result).Kind() != reflect.Ptr {
 		return false, fmt.Errorf("[CacheQuery]Result must be a Pointer")
@@ -94,23 +120,50 @@ func (c *DBQuery) SelectOne(cqer DBQueryer) (bool, error) {
 	rvalue := reflect.ValueOf(Result).Elem()
 
 	if UseCache == true { //do use cache
-		if isget, err := c.Cache.Get(CacheKey, Result); isget != true { //cache miss or error
-			if err != nil {
-				return false, fmt.Errorf("[error]CacheQuery get cache: %s", err.Error())
+		loaded := false
+		isget, err = cache.GetOrLoad(CacheKey, Result, CacheExpire, func(ctx context.Context, dst interface{}) (bool, error) {
+			if dst != Result { //异步刷新时dst为新创建的值，请求已结束，使用刷新的span与新的DebugInfo
+				return c.selectOne(trace.SpanFromContext(ctx), DbName, SQL, SQLcondition, rtype, reflect.ValueOf(dst).Elem(), NewDebugInfo())
 			}
+			loaded = true
 			debug.Add(fmt.Sprintf("Cache Miss: %s", CacheKey))
-		} else {
+			return c.selectOne(span, DbName, SQL, SQLcondition, rtype, rvalue, debug)
+		}, c.loadOptions(ctx, DB)...)
+		if err != nil {
+			return false, err
+		}
+		if isget && loaded {
+			debug.Add(fmt.Sprintf("Cache Set: %s TTL: %d", CacheKey, CacheExpire))
+		} else if isget {
 			debug.Add(fmt.Sprintf("Cache Get: %s", CacheKey))
-
-			return true, nil
+		} else if !loaded && DB.NegativeExpireTime > 0 {
+			debug.Add(fmt.Sprintf("Cache Get Negative: %s", CacheKey))
 		}
+		return isget, nil
 	}
 
-	dbconn, err := c.ReadMSBalancer(DbName)
+	return c.selectOne(span, DbName, SQL, SQLcondition, rtype, rvalue, debug)
+}
+
+// loadOptions 按DBQueryBuilder的设置生成GetOrLoad的参数
+func (c *DBQuery) loadOptions(ctx context.Context, DB *DBQueryBuilder) []CacheOption {
+	opts := append(loadOptions(ctx, c.CacheLock, DB.LoadLock, DB.SoftExpireTime), WithTags(DB.CacheTags...))
+	if DB.NegativeExpireTime > 0 {
+		opts = append(opts, WithNegativeTTL(time.Duration(DB.NegativeExpireTime)*time.Second))
+	}
+	return opts
+}
+
+// selectOne 查询DB并将第一行写入rvalue
+func (c *DBQuery) selectOne(span trace.Span, DbName string, SQL string, SQLcondition []interface{}, rtype reflect.Type, rvalue reflect.Value, debug *DebugInfo) (bool, error) {
+	dbconn, role, err := c.readMSBalancer(DbName)
 	if err != nil {
 		return false, fmt.Errorf("[error]CacheQuery: %s", err.Error())
 	}
+	span.SetAttributes(attribute.String("db.role", role))
+	start := time.Now()
 	rows, err := dbconn.Query(SQL, SQLcondition...)
+	c.Metrics.ObserveDBQuery(DbName, role, "select_one", err, start)
 	if err != nil {
 		return false, fmt.Errorf("[error]CacheQuery DB query action: %w", err)
 	}
@@ -140,13 +193,6 @@ func (c *DBQuery) SelectOne(cqer DBQueryer) (bool, error) {
 				return false, fmt.Errorf("[error]CacheQuery DB scan action: %w", err)
 			}
 		}
-		if UseCache == true { //do use cache
-			err = c.Cache.Set(CacheKey, Result, CacheExpire)
-			if err != nil {
-				return false, fmt.Errorf("[error]CacheQuery set cache: %s", err.Error())
-			}
-			debug.Add(fmt.Sprintf("Cache Set: %s TTL: %d", CacheKey, CacheExpire))
-		}
 	} else {
 		return false, nil
 	}
@@ -155,13 +201,15 @@ func (c *DBQuery) SelectOne(cqer DBQueryer) (bool, error) {
 }
 
 // SelectMulti 多条查询方法
-func (c *DBQuery) SelectMulti(cqer DBQueryer) (bool, error) {
+func (c *DBQuery) SelectMulti(cqer DBQueryer) (isget bool, err error) {
 	c.AddCounter()
 	defer c.SubCounter()
 
 	DB := cqer.GetBuilder()
 	SQL := DB.SQL
 	SQLcondition := DB.SQLcondition
+	ctx, span := startSpan(c.Tracer, DB.CommonParams.GetContext(), "db.select_multi", trace.WithAttributes(attribute.String("db.name", cqer.GetDbname()), attribute.String("db.statement", SQL)))
+	defer func() { c.finish(span, "select_multi", cqer.GetDbname(), SQL, err) }()
 	Result := DB.Result
 	CacheKey := cqer.GetCacheKey()
 	CacheExpire := cqer.GetCacheExpire()
@@ -169,6 +217,13 @@ func (c *DBQuery) SelectMulti(cqer DBQueryer) (bool, error) {
 	DbName := cqer.GetDbname()
 	UseCache := cqer.IsUseCache()
 
+	var cache *Cache
+	if UseCache == true {
+		if cache, err = cacheFor(c.Cache, c.Caches, DB.CacheName); err != nil {
+			return false, fmt.Errorf("[error]CacheQuery select cache: %w", err)
+		}
+	}
+
 	//Result Must Be A ptr to slice
 	if reflect.TypeOf(Result).Kind() != reflect.Ptr && reflect.TypeOf(Result).Elem().Kind() != reflect.Slice {
 		return false, fmt.Errorf("[CacheQuery]Result must be a Pointer of slice")
@@ -178,23 +233,41 @@ func (c *DBQuery) SelectMulti(cqer DBQueryer) (bool, error) {
 	rvalue := reflect.ValueOf(Result).Elem() //indeed a slice
 
 	if UseCache == true { //do use cache
-		if isget, err := c.Cache.Get(CacheKey, Result); isget != true { //cache miss or error
-			if err != nil {
-				return false, fmt.Errorf("[CacheQuery]get cache: %s", err.Error())
+		loaded := false
+		isget, err = cache.GetOrLoad(CacheKey, Result, CacheExpire, func(ctx context.Context, dst interface{}) (bool, error) {
+			if dst != Result { //异步刷新时dst为新创建的值，请求已结束，使用刷新的span与新的DebugInfo
+				return c.selectMulti(trace.SpanFromContext(ctx), DbName, SQL, SQLcondition, rtype, reflect.ValueOf(dst).Elem(), NewDebugInfo())
 			}
-
+			loaded = true
 			debug.Add(fmt.Sprintf("Cache Miss: %s", CacheKey))
-		} else {
+			return c.selectMulti(span, DbName, SQL, SQLcondition, rtype, rvalue, debug)
+		}, c.loadOptions(ctx, DB)...)
+		if err != nil {
+			return false, err
+		}
+		if isget && loaded {
+			debug.Add(fmt.Sprintf("Cache Set: %s TTL: %d", CacheKey, CacheExpire))
+		} else if isget {
 			debug.Add(fmt.Sprintf("Cache Get: %s", CacheKey))
-			return true, nil
+		} else if !loaded && DB.NegativeExpireTime > 0 {
+			debug.Add(fmt.Sprintf("Cache Get Negative: %s", CacheKey))
 		}
+		return isget, nil
 	}
 
-	dbconn, err := c.ReadMSBalancer(DbName)
+	return c.selectMulti(span, DbName, SQL, SQLcondition, rtype, rvalue, debug)
+}
+
+// selectMulti 查询DB并将全部行追加到rvalue
+func (c *DBQuery) selectMulti(span trace.Span, DbName string, SQL string, SQLcondition []interface{}, rtype reflect.Type, rvalue reflect.Value, debug *DebugInfo) (bool, error) {
+	dbconn, role, err := c.readMSBalancer(DbName)
 	if err != nil {
 		return false, fmt.Errorf("[error]CacheQuery: %s", err.Error())
 	}
+	span.SetAttributes(attribute.String("db.role", role))
+	start := time.Now()
 	rows, err := dbconn.Query(SQL, SQLcondition...)
+	c.Metrics.ObserveDBQuery(DbName, role, "select_multi", err, start)
 
 	if err != nil {
 		return false, fmt.Errorf("[CacheQuery]DB query action: %w", err)
@@ -239,25 +312,20 @@ func (c *DBQuery) SelectMulti(cqer DBQueryer) (bool, error) {
 	if rowc == 0 {
 		return false, nil
 	}
-	if UseCache == true { //do use cache
-		err = c.Cache.Set(CacheKey, Result, CacheExpire)
-		if err != nil {
-			return false, fmt.Errorf("[CacheQuery]set cache: %s", err.Error())
-		}
-		debug.Add(fmt.Sprintf("Cache Set: %s TTL: %d", CacheKey, CacheExpire))
-	}
 
 	return true, nil
 }
 
 // EXEC 数据执行类 insert update 等请用此函数
-func (c *DBQuery) EXEC(cqer DBQueryer) (int64, error) {
+func (c *DBQuery) EXEC(cqer DBQueryer) (num int64, err error) {
 	c.AddCounter()
 	defer c.SubCounter()
 
 	DB := cqer.GetBuilder()
 	SQL := DB.SQL
 	SQLcondition := DB.SQLcondition
+	_, span := startSpan(c.Tracer, DB.CommonParams.GetContext(), "db.exec", trace.WithAttributes(attribute.String("db.name", cqer.GetDbname()), attribute.String("db.statement", SQL)))
+	defer func() { c.finish(span, "exec", cqer.GetDbname(), SQL, err) }()
 	debug := cqer.GetDebugInfo()
 
 	debug.Add(fmt.Sprintf("EXEC DB Query: %s , Query Condition: %s", SQL, SQLcondition))
@@ -267,12 +335,15 @@ func (c *DBQuery) EXEC(cqer DBQueryer) (int64, error) {
 		return 0, fmt.Errorf("[error]CacheQuery exec: can't find this db config '%s'", DbName)
 	}
 
+	start := time.Now()
 	stmt, err := c.DBset[DbName].Master.Prepare(SQL)
 	if err != nil {
+		c.Metrics.ObserveDBQuery(DbName, "master", "exec", err, start)
 		return 0, fmt.Errorf("[error]CacheQuery stmt sql: %w", err)
 	}
 	defer stmt.Close()
 	res, err2 := stmt.Exec(SQLcondition...)
+	c.Metrics.ObserveDBQuery(DbName, "master", "exec", err2, start)
 	if err2 != nil {
 		return 0, fmt.Errorf("[error]CacheQuery exe sql: %w", err2)
 	}
@@ -295,6 +366,14 @@ func (c *DBQuery) EXEC(cqer DBQueryer) (int64, error) {
 	return 0, nil
 }
 
+// finish 记录失败的查询并结束span
+func (c *DBQuery) finish(span trace.Span, op string, dbname string, SQL string, err error) {
+	if err != nil {
+		loggerOr(c.Logger).Error("CacheQuery "+op, slog.String("db", dbname), slog.String("sql", SQL), slog.Any("error", err))
+	}
+	endSpan(span, err)
+}
+
 // GetTX 事务类，返回一个tx连接
 func (c *DBQuery) GetTX(cqer DBQueryer) (*sql.Tx, error) {
 	return c.DBset[cqer.GetDbname()].Master.Begin()
@@ -302,22 +381,28 @@ func (c *DBQuery) GetTX(cqer DBQueryer) (*sql.Tx, error) {
 
 // ReadMSBalancer 轮询使用master或者slave进行查询
 func (c *DBQuery) ReadMSBalancer(DbName string) (*sql.DB, error) {
+	db, _, err := c.readMSBalancer(DbName)
+	return db, err
+}
+
+// readMSBalancer 轮询使用master或者slave进行查询，同时返回所选角色master或slave
+func (c *DBQuery) readMSBalancer(DbName string) (*sql.DB, string, error) {
 	c.RWflagLock.Lock()
 	defer c.RWflagLock.Unlock()
 	if _, ok := c.DBset[DbName]; !ok { //key不存在
-		return nil, fmt.Errorf("[error]CacheQuery ReadMSBalancer: can't find this db config '%s'", DbName)
+		return nil, "", fmt.Errorf("[error]CacheQuery ReadMSBalancer: can't find this db config '%s'", DbName)
 	}
 	if c.RWflag == 0 {
 		c.RWflag = 1
-		return c.DBset[DbName].Master, nil
+		return c.DBset[DbName].Master, "master", nil
 	}
 
 	c.RWflag = 0
 	if c.DBset[DbName].Slave != nil {
-		return c.DBset[DbName].Slave, nil
+		return c.DBset[DbName].Slave, "slave", nil
 	}
 
-	return c.DBset[DbName].Master, nil
+	return c.DBset[DbName].Master, "master", nil
 }
 
 // deepCopy 深拷贝方法
@@ -0,0 +1,221 @@
+package letsgo
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Job 延迟队列中到期取出的任务
+type Job struct {
+	ID         string
+	Type       string
+	Data       []byte //编码后的值，使用Decode解码
+	Deliveries int64  //包括本次在内的投递次数
+	item       *QueueItem
+}
+
+// Decode 将任务数据解码到DataStruct
+func (j *Job) Decode(DataStruct interface{}) error {
+	data, err := decompressValue(j.Data)
+	if err == nil {
+		err = decodeValue(data, DataStruct, j.item.legacy)
+	}
+	if err != nil {
+		return fmt.Errorf("[error]DelayQueue decode job %s: %s", j.ID, err.Error())
+	}
+	return nil
+}
+
+// JobHandler 处理一个任务，返回错误时按RetryDelay延迟重试，投递次数达到MaxDeliveries后移入死信列表
+type JobHandler func(ctx context.Context, job *Job) error
+
+// DelayQueue 基于redis有序集合的延迟队列，到期任务由Promote原子地移入可靠队列，取出、确认与死信沿用ReliableQueue
+// 有序集合以到期时间的毫秒数为分值、任务ID为成员，任务内容保存在hash中
+type DelayQueue struct {
+	*ReliableQueue
+	handlers map[string]JobHandler
+	lock     sync.RWMutex
+}
+
+// NewDelayQueue 返回名为name的延迟队列，只支持redis
+func (c *Cache) NewDelayQueue(name string, opts ReliableQueueOptions) *DelayQueue {
+	return &DelayQueue{ReliableQueue: c.NewReliableQueue(name, opts), handlers: make(map[string]JobHandler)}
+}
+
+func (q *DelayQueue) delayedKey() string { return q.Cache.Key("{" + q.Name + "}:delayed") }
+
+func (q *DelayQueue) jobsKey() string { return q.Cache.Key("{" + q.Name + "}:jobs") }
+
+// Schedule 编码DataStruct为jobType类型的任务，delay后到期，返回任务ID
+func (q *DelayQueue) Schedule(jobType string, DataStruct interface{}, delay time.Duration, opts ...CacheOption) (string, error) {
+	return q.ScheduleAt(jobType, DataStruct, time.Now().Add(delay), opts...)
+}
+
+// ScheduleAt 编码DataStruct为jobType类型的任务，在at到期，返回任务ID
+func (q *DelayQueue) ScheduleAt(jobType string, DataStruct interface{}, at time.Time, opts ...CacheOption) (string, error) {
+	o := newCacheOptions(opts)
+	data, err := encodeValue(q.Cache.codec(o), DataStruct)
+	if err != nil {
+		return "", fmt.Errorf("[error]DelayQueue %s marshall struct: %s", q.Name, err.Error())
+	}
+	if data, err = q.Cache.compress(data); err != nil {
+		return "", err
+	}
+
+	//任务内容为ID、类型长度、类型加编码后的值
+	id := genRequestID()
+	raw := append([]byte(id), binary.AppendUvarint(nil, uint64(len(jobType)))...)
+	raw = append(append(raw, jobType...), data...)
+	_, err = q.do("schedule", func(conn redis.Conn) (interface{}, error) {
+		conn.Send("MULTI")
+		conn.Send("HSET", q.jobsKey(), id, raw)
+		conn.Send("ZADD", q.delayedKey(), at.UnixMilli(), id)
+		return conn.Do("EXEC")
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// luaDelayCancel 从有序集合与hash中删除任务
+// KEYS: delayed jobs deliveries  ARGV: id
+var luaDelayCancel = redis.NewScript(3, `
+	if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HDEL", KEYS[2], ARGV[1])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	return 1
+`)
+
+// Cancel 取消尚未到期的任务，任务不存在或已移入可靠队列时返回false
+func (q *DelayQueue) Cancel(id string) (bool, error) {
+	reply, err := q.do("cancel", func(conn redis.Conn) (interface{}, error) {
+		return redis.Int(luaDelayCancel.Do(conn, q.delayedKey(), q.jobsKey(), q.deliveriesKey(), id))
+	})
+	if err != nil {
+		return false, err
+	}
+	return reply.(int) == 1, nil
+}
+
+// luaDelayPromote 将最多limit个到期任务按到期时间顺序移入可靠队列
+// KEYS: delayed jobs ready  ARGV: now limit
+var luaDelayPromote = redis.NewScript(3, `
+	local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, tonumber(ARGV[2]))
+	for _, id in ipairs(ids) do
+		local raw = redis.call("HGET", KEYS[2], id)
+		if raw then
+			redis.call("LPUSH", KEYS[3], raw)
+			redis.call("HDEL", KEYS[2], id)
+		end
+		redis.call("ZREM", KEYS[1], id)
+	end
+	return #ids
+`)
+
+// Promote 将最多limit个到期任务移入可靠队列，返回移动的数量，多个实例同时执行是安全的
+func (q *DelayQueue) Promote(limit int) (int, error) {
+	reply, err := q.do("promote", func(conn redis.Conn) (interface{}, error) {
+		return redis.Int(luaDelayPromote.Do(conn, q.delayedKey(), q.jobsKey(), q.readyKey(), time.Now().UnixMilli(), limit))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int), nil
+}
+
+// Delayed 返回尚未到期的任务数
+func (q *DelayQueue) Delayed() (int64, error) {
+	reply, err := q.do("delayed", func(conn redis.Conn) (interface{}, error) {
+		return redis.Int64(conn.Do("ZCARD", q.delayedKey()))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reply.(int64), nil
+}
+
+// Handle 注册jobType类型任务的处理函数
+func (q *DelayQueue) Handle(jobType string, handler JobHandler) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// handler 返回jobType类型任务的处理函数
+func (q *DelayQueue) handler(jobType string) JobHandler {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.handlers[jobType]
+}
+
+// PopJob 以consumer的身份取出一个到期任务，timeout内没有任务时返回nil，处理后需调用AckJob或RetryJob
+func (q *DelayQueue) PopJob(consumer string, timeout time.Duration) (*Job, error) {
+	item, err := q.Pop(consumer, timeout)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	job := &Job{ID: item.ID, Deliveries: item.Deliveries, item: item}
+	n, size := binary.Uvarint(item.Data)
+	if size <= 0 || uint64(len(item.Data)-size) < n {
+		//无法解析的任务直接移入死信列表
+		q.requeueDead(item)
+		return nil, fmt.Errorf("[error]DelayQueue %s invalid job %s", q.Name, item.ID)
+	}
+	job.Type = string(item.Data[size : size+int(n)])
+	job.Data = item.Data[size+int(n):]
+	return job, nil
+}
+
+// AckJob 确认任务已处理
+func (q *DelayQueue) AckJob(job *Job) error {
+	return q.Ack(job.item)
+}
+
+// luaDelayRetry 将处理中的任务放回有序集合，投递次数达到上限时移入死信列表，保留投递次数
+// KEYS: processing dead delayed jobs deadlines deliveries  ARGV: raw id max due
+// 返回 0未处理 1延迟重试 2移入死信列表
+var luaDelayRetry = redis.NewScript(6, `
+	if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HDEL", KEYS[5], ARGV[2])
+	local deliveries = tonumber(redis.call("HGET", KEYS[6], ARGV[2]) or "0")
+	if tonumber(ARGV[3]) > 0 and deliveries >= tonumber(ARGV[3]) then
+		redis.call("HDEL", KEYS[6], ARGV[2])
+		redis.call("LPUSH", KEYS[2], ARGV[1])
+		return 2
+	end
+	redis.call("HSET", KEYS[4], ARGV[2], ARGV[1])
+	redis.call("ZADD", KEYS[3], ARGV[4], ARGV[2])
+	return 1
+`)
+
+// RetryJob 处理失败，任务在delay后再次到期，投递次数达到MaxDeliveries时移入死信列表，返回是否移入死信列表
+func (q *DelayQueue) RetryJob(job *Job, delay time.Duration) (bool, error) {
+	return q.retry(job.item, q.Options.MaxDeliveries, delay)
+}
+
+// requeueDead 将处理中的元素直接移入死信列表
+func (q *DelayQueue) requeueDead(item *QueueItem) {
+	q.retry(item, 1, 0)
+}
+
+// retry 执行luaDelayRetry
+func (q *DelayQueue) retry(item *QueueItem, max int64, delay time.Duration) (bool, error) {
+	reply, err := q.do("retry", func(conn redis.Conn) (interface{}, error) {
+		return redis.Int(luaDelayRetry.Do(conn, q.processingKey(item.Consumer), q.deadKey(), q.delayedKey(), q.jobsKey(), q.deadlinesKey(), q.deliveriesKey(),
+			item.raw, item.ID, max, time.Now().Add(delay).UnixMilli()))
+	})
+	if err != nil {
+		return false, err
+	}
+	return reply.(int) == 2, nil
+}
@@ -0,0 +1,191 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// promoteBatch 每次Promote移动的最大任务数
+const promoteBatch = 100
+
+// DelayWorkerOptions 延迟队列工人配置
+type DelayWorkerOptions struct {
+	Consumer     string        //消费者名称，为空时使用主机名加随机串
+	Concurrency  int           //并发处理任务的协程数，默认1
+	PollInterval time.Duration //移动到期任务的间隔及取任务的最长阻塞时间，默认1秒，需小于redis连接的读超时
+	RetryDelay   time.Duration //第n次处理失败后延迟RetryDelay*n重试，默认5秒
+	ReapInterval time.Duration //将超时未确认的任务放回队列的间隔，默认VisibilityTimeout的一半，不小于minReapInterval
+}
+
+// minReapInterval 默认放回间隔的下限，避免VisibilityTimeout很小时ticker间隔为0
+const minReapInterval = 100 * time.Millisecond
+
+// DelayWorker 延迟队列工人，定时移动到期任务并按类型交给注册的JobHandler处理，成功后确认
+type DelayWorker struct {
+	Queue   *DelayQueue
+	Options DelayWorkerOptions
+	Logger  *slog.Logger
+	workerLifecycle
+}
+
+// NewWorker 返回一个DelayWorker结构体指针，需调用Start开始处理
+func (q *DelayQueue) NewWorker(opts DelayWorkerOptions) *DelayWorker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+	if opts.ReapInterval <= 0 {
+		opts.ReapInterval = max(q.Options.VisibilityTimeout/2, minReapInterval)
+	}
+	if opts.Consumer == "" {
+		hostname, _ := os.Hostname()
+		opts.Consumer = hostname + "-" + genRequestID()[:8]
+	}
+	return &DelayWorker{Queue: q, Options: opts, Logger: q.Logger}
+}
+
+// Start 开始处理任务，重复调用返回错误
+func (w *DelayWorker) Start() error {
+	if !w.start(w.run) {
+		return fmt.Errorf("[error]DelayWorker %s already started", w.Queue.Name)
+	}
+	return nil
+}
+
+// Stop 停止取新任务并等待处理中的任务完成，ctx到期时取消Handler的ctx并返回错误
+// 未完成的任务超过VisibilityTimeout后由其他工人放回队列
+func (w *DelayWorker) Stop(ctx context.Context) error {
+	if err := w.shutdown(ctx); err != nil {
+		return fmt.Errorf("[error]DelayWorker %s stop: %w", w.Queue.Name, err)
+	}
+	return nil
+}
+
+// run 启动维护协程与处理协程，stop关闭后等待全部结束
+func (w *DelayWorker) run() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.maintain()
+	}()
+	for k := 0; k < w.Options.Concurrency; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume()
+		}()
+	}
+	wg.Wait()
+}
+
+// maintain 定时移动到期任务，并将超时未确认的任务放回队列
+func (w *DelayWorker) maintain() {
+	logger := loggerOr(w.Logger)
+	promote := time.NewTicker(w.Options.PollInterval)
+	defer promote.Stop()
+	reap := time.NewTicker(w.Options.ReapInterval)
+	defer reap.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-promote.C:
+			for {
+				moved, err := w.Queue.Promote(promoteBatch)
+				if err != nil {
+					logger.Warn("DelayWorker promote", slog.String("queue", w.Queue.Name), slog.Any("error", err))
+				}
+				if err != nil || moved < promoteBatch {
+					break
+				}
+			}
+		case <-reap.C:
+			if _, _, err := w.Queue.Reap(); err != nil {
+				logger.Warn("DelayWorker reap", slog.String("queue", w.Queue.Name), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// consume 循环取出到期任务并处理，出错时退避重试
+func (w *DelayWorker) consume() {
+	logger := loggerOr(w.Logger)
+	backoff := 100 * time.Millisecond
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		job, err := w.Queue.PopJob(w.Options.Consumer, w.Options.PollInterval)
+		if err != nil {
+			logger.Warn("DelayWorker pop", slog.String("queue", w.Queue.Name), slog.Duration("retry_after", backoff), slog.Any("error", err))
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > 5*time.Second {
+				backoff = 5 * time.Second
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+		if job != nil {
+			w.handle(job)
+		}
+	}
+}
+
+// handle 调用任务类型对应的Handler，成功后确认，失败或panic时延迟重试
+func (w *DelayWorker) handle(job *Job) {
+	logger := loggerOr(w.Logger)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(logger, r)
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		handler := w.Queue.handler(job.Type)
+		if handler == nil {
+			return fmt.Errorf("no handler for job type %s", job.Type)
+		}
+		return handler(w.ctx, job)
+	}()
+	if err == nil {
+		if err := w.Queue.AckJob(job); err != nil {
+			logger.Warn("DelayWorker ack job", slog.String("queue", w.Queue.Name), slog.String("id", job.ID), slog.Any("error", err))
+		}
+		return
+	}
+
+	logger.Warn("DelayWorker handle job", slog.String("queue", w.Queue.Name), slog.String("type", job.Type), slog.String("id", job.ID), slog.Int64("deliveries", job.Deliveries), slog.Any("error", err))
+	dead, err := w.Queue.RetryJob(job, w.Options.RetryDelay*time.Duration(job.Deliveries))
+	if err != nil {
+		logger.Warn("DelayWorker retry job", slog.String("queue", w.Queue.Name), slog.String("id", job.ID), slog.Any("error", err))
+	} else if dead {
+		logger.Error("DelayWorker move job to dead letter list", slog.String("queue", w.Queue.Name), slog.String("type", job.Type), slog.String("id", job.ID), slog.Int64("deliveries", job.Deliveries))
+	}
+}
+
+// StartDelayWorker 启动延迟队列工人，ShutdownCoordinator关闭时在等待在途任务前停止
+func (L *Letsgo) StartDelayWorker(q *DelayQueue, opts DelayWorkerOptions) (*DelayWorker, error) {
+	w := q.NewWorker(opts)
+	if err := w.Start(); err != nil {
+		return nil, err
+	}
+	L.addWorker(w)
+	return w, nil
+}
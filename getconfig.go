@@ -2,6 +2,7 @@ package letsgo
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -19,7 +20,7 @@ type ConfigSet struct {
 	ConfigSet map[string]*SingleConfigHashMap
 }
 
-//CONFIG_SET 常驻内存的变量
+//CONFIG_SET 常驻内存的变量，为Default实例使用的配置集
 var CONFIG_SET = new(ConfigSet)
 
 //InitConfig 初始化config
@@ -27,6 +28,11 @@ func InitConfig() {
 	CONFIG_SET.ConfigSet = make(map[string]*SingleConfigHashMap)
 }
 
+//newConfigSet 返回一个ConfigSet结构体指针
+func newConfigSet() *ConfigSet {
+	return &ConfigSet{ConfigSet: make(map[string]*SingleConfigHashMap)}
+}
+
 //Get SingleConfig 获取具体配置项方法
 func (SC *SingleConfigHashMap) Get(ConfigName string) (string, bool) {
 	SC.RwLock.RLock()
@@ -44,42 +50,44 @@ func (SC *SingleConfigHashMap) Set(ConfigName string, ConfigValue string) {
 	SC.Config[ConfigName] = ConfigValue
 }
 
-//GetConfig 获取配置集方法
+//GetConfig 获取配置集方法，读写letsgo自身的配置集
 func GetConfig(letsgo *Letsgo, ConfigSetName string) *SingleConfigHashMap {
-	CONFIG_SET.RwLock.Lock() //因为包含写操作，要加写锁
-	defer CONFIG_SET.RwLock.Unlock()
+	configset := letsgo.configSet()
+	configset.RwLock.Lock() //因为包含写操作，要加写锁
+	defer configset.RwLock.Unlock()
 
-	if _, ok := CONFIG_SET.ConfigSet[ConfigSetName]; !ok { //没有从set获取到config_name对应的config
-		CONFIG_SET.ConfigSet[ConfigSetName] = &SingleConfigHashMap{Config: make(map[string]string)}
+	if _, ok := configset.ConfigSet[ConfigSetName]; !ok { //没有从set获取到config_name对应的config
+		configset.ConfigSet[ConfigSetName] = &SingleConfigHashMap{Config: make(map[string]string)}
 	}
 
-	if len(CONFIG_SET.ConfigSet[ConfigSetName].Config) == 0 { //获取到的config长度为0
+	if len(configset.ConfigSet[ConfigSetName].Config) == 0 { //获取到的config长度为0
 		err := SetConfig(letsgo, ConfigSetName)
 		if err != nil {
-			letsgo.Logger.Println("Lib getconfig error:", err.Error())
+			letsgo.logger().Error("Lib getconfig", slog.String("config_set", ConfigSetName), slog.Any("error", err))
 		}
-	} else if CONFIG_SET.ConfigSet[ConfigSetName].ConfigTTL+600 <= time.Now().Unix() { //过期了
+	} else if configset.ConfigSet[ConfigSetName].ConfigTTL+600 <= time.Now().Unix() { //过期了
 		err := SetConfig(letsgo, ConfigSetName)
 		if err != nil {
-			letsgo.Logger.Println("Lib getconfig error:", err.Error())
+			letsgo.logger().Error("Lib getconfig", slog.String("config_set", ConfigSetName), slog.Any("error", err))
 		}
 	}
 
-	return CONFIG_SET.ConfigSet[ConfigSetName]
+	return configset.ConfigSet[ConfigSetName]
 }
 
-//SetConfig 设置配置集方法
+//SetConfig 设置配置集方法，调用方需持有配置集的写锁
 func SetConfig(letsgo *Letsgo, ConfigSetName string) error {
+	configset := letsgo.configSet()
 	switch ConfigSetName {
 	case "EXAMPLE_SET":
 		//init
 
-		CONFIG_SET.ConfigSet[ConfigSetName].RwLock.Lock()
-		CONFIG_SET.ConfigSet[ConfigSetName].Config["ex"] = "123"
-		CONFIG_SET.ConfigSet[ConfigSetName].RwLock.Unlock()
+		configset.ConfigSet[ConfigSetName].RwLock.Lock()
+		configset.ConfigSet[ConfigSetName].Config["ex"] = "123"
+		configset.ConfigSet[ConfigSetName].RwLock.Unlock()
 
-		CONFIG_SET.ConfigSet[ConfigSetName].ConfigTTL = time.Now().Unix()
-		letsgo.Logger.Println("Lib getconfig load", ConfigSetName, "success!")
+		configset.ConfigSet[ConfigSetName].ConfigTTL = time.Now().Unix()
+		letsgo.logger().Info("Lib getconfig load success", slog.String("config_set", ConfigSetName))
 		return nil
 
 	default:
@@ -87,3 +95,20 @@ func SetConfig(letsgo *Letsgo, ConfigSetName string) error {
 	}
 
 }
+
+//configSet 返回Letsgo自身的配置集，未调用InitMemConfig时在initLock下创建，只有Default使用全局CONFIG_SET
+func (L *Letsgo) configSet() *ConfigSet {
+	L.initLock.Lock()
+	defer L.initLock.Unlock()
+	if L.Config == nil {
+		if L == Default {
+			if CONFIG_SET.ConfigSet == nil {
+				InitConfig()
+			}
+			L.Config = CONFIG_SET
+		} else {
+			L.Config = newConfigSet()
+		}
+	}
+	return L.Config
+}
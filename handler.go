@@ -44,6 +44,9 @@ func GenCommparams(c echo.Context) *CommonParams {
 		commp.SetParam("did", params[5])
 		commp.SetParam("useragent", c.Request().UserAgent())
 		commp.SetParam("debug", params[6])
+
+		//TraceMiddleware设置的请求id、ctx与日志
+		requestParams(c, &commp)
 	}
 
 	return &commp
@@ -0,0 +1,285 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/labstack/echo/v4"
+)
+
+// 健康状态
+const (
+	HealthUp       = "up"
+	HealthDown     = "down"
+	HealthDegraded = "degraded" //仅非关键依赖异常
+)
+
+// HealthProbe 依赖探测函数，返回nil表示依赖可用
+type HealthProbe func(ctx context.Context) error
+
+// HealthCheck 单个依赖的探测描述
+type HealthCheck struct {
+	Name     string
+	Critical bool //关键依赖异常时readyz返回503
+	Probe    HealthProbe
+}
+
+// HealthResult 单个依赖的探测结果
+type HealthResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport 所有依赖的探测汇总
+type HealthReport struct {
+	Status string         `json:"status"`
+	Checks []HealthResult `json:"checks"`
+}
+
+// Health 健康检查结构体
+type Health struct {
+	L        *Letsgo
+	Timeout  time.Duration   //单个依赖探测超时
+	Critical map[string]bool //按名称覆盖依赖的关键性
+	checks   []HealthCheck
+	running  map[string]bool //仍在执行的探测，超时后未返回的探测结束前不再重复发起
+	lock     sync.RWMutex
+}
+
+// newHealth 返回一个Health结构体指针
+func newHealth(L *Letsgo) *Health {
+	return &Health{L: L, Timeout: 2 * time.Second, Critical: make(map[string]bool), running: make(map[string]bool)}
+}
+
+// InitHealth 初始化健康检查
+func (L *Letsgo) InitHealth() {
+	L.Health = newHealth(L)
+}
+
+// Register 注册自定义依赖探测
+func (h *Health) Register(check HealthCheck) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// SetCritical 设置某个依赖是否为关键依赖，name如db:main:master、cache:redis、rpc:user
+func (h *Health) SetCritical(name string, critical bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.Critical[name] = critical
+}
+
+// Checks 根据Letsgo当前已初始化的组件生成全部探测
+func (h *Health) Checks() []HealthCheck {
+	var checks []HealthCheck
+	L := h.L
+
+	dbnames := make([]string, 0, len(L.DBC))
+	for name := range L.DBC {
+		dbnames = append(dbnames, name)
+	}
+	sort.Strings(dbnames)
+	for _, name := range dbnames {
+		dbset := L.DBC[name]
+		master := dbset.Master
+		checks = append(checks, HealthCheck{Name: "db:" + name + ":master", Critical: true, Probe: func(ctx context.Context) error {
+			return master.PingContext(ctx)
+		}})
+		if dbset.Slave != nil {
+			slave := dbset.Slave
+			checks = append(checks, HealthCheck{Name: "db:" + name + ":slave", Critical: true, Probe: func(ctx context.Context) error {
+				return slave.PingContext(ctx)
+			}})
+		}
+	}
+
+	for _, cache := range L.allCaches() {
+		name := cache.Name
+		if name == "" {
+			name = cache.backend()
+		}
+		switch cache.UseRedisOrMemcached {
+		case 1:
+			mc := cache.Memcached
+			checks = append(checks, HealthCheck{Name: "cache:" + name, Critical: true, Probe: func(ctx context.Context) error {
+				return mc.Ping()
+			}})
+		case 2:
+			rd := cache.Redis
+			checks = append(checks, HealthCheck{Name: "cache:" + name, Critical: true, Probe: func(ctx context.Context) error {
+				conn := rd.GetConn(false)
+				defer conn.Close()
+				_, err := redis.DoContext(conn, ctx, "PING")
+				return err
+			}})
+		}
+	}
+
+	if L.MicroserviceClient != nil {
+		msc := L.MicroserviceClient
+		checks = append(checks, HealthCheck{Name: "microservice", Critical: false, Probe: func(ctx context.Context) error {
+			if !msc.IsActive() {
+				return fmt.Errorf("microservice client inactive")
+			}
+			if pinger, ok := msc.(interface{ Ping() error }); ok {
+				return pinger.Ping()
+			}
+			return nil
+		}})
+	}
+
+	if L.JSONRPCClient != nil {
+		L.JSONRPCClient.Lock.Lock()
+		services := make([]string, 0, len(L.JSONRPCClient.Service))
+		for service := range L.JSONRPCClient.Service {
+			services = append(services, service)
+		}
+		L.JSONRPCClient.Lock.Unlock()
+		sort.Strings(services)
+		for _, service := range services {
+			service := service
+			rpcclient := L.JSONRPCClient
+			checks = append(checks, HealthCheck{Name: "rpc:" + service, Critical: false, Probe: func(ctx context.Context) error {
+				client, err := rpcclient.Dial(service)
+				if err != nil {
+					return err
+				}
+				return client.Close()
+			}})
+		}
+	}
+
+	h.lock.RLock()
+	checks = append(checks, h.checks...)
+	for k := range checks {
+		if critical, ok := h.Critical[checks[k].Name]; ok {
+			checks[k].Critical = critical
+		}
+	}
+	h.lock.RUnlock()
+
+	return checks
+}
+
+// Run 并发执行全部探测并汇总结果
+func (h *Health) Run(ctx context.Context) HealthReport {
+	checks := h.Checks()
+	results := make([]HealthResult, len(checks))
+
+	var wg sync.WaitGroup
+	for k, check := range checks {
+		wg.Add(1)
+		go func(k int, check HealthCheck) {
+			defer wg.Done()
+			results[k] = h.probe(ctx, check)
+		}(k, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthUp, Checks: results}
+	for _, result := range results {
+		if result.Status == HealthUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthDown
+			break
+		}
+		report.Status = HealthDegraded
+	}
+	return report
+}
+
+// probe 带超时执行单个探测，探测内部panic视为失败
+// 超时后ctx随即取消，不响应ctx的探测协程在返回前同名探测直接判定失败，避免协程与依赖连接不断累积
+func (h *Health) probe(ctx context.Context, check HealthCheck) HealthResult {
+	result := HealthResult{Name: check.Name, Critical: check.Critical, Status: HealthUp}
+
+	h.lock.Lock()
+	if h.running[check.Name] {
+		h.lock.Unlock()
+		result.Status = HealthDown
+		result.Error = "previous probe still running"
+		return result
+	}
+	if h.running == nil {
+		h.running = make(map[string]bool)
+	}
+	h.running[check.Name] = true
+	h.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			h.lock.Lock()
+			delete(h.running, check.Name)
+			h.lock.Unlock()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("probe panic: %v", r)
+			}
+		}()
+		done <- check.Probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("probe timeout after %s", h.Timeout)
+	}
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HealthzHandler 存活探测，只要进程可以响应即返回200，不访问任何依赖；依赖状态见ReadyzHandler
+func (L *Letsgo) HealthzHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, HealthReport{Status: HealthUp, Checks: []HealthResult{}})
+	}
+}
+
+// ReadyzHandler 就绪探测，任一关键依赖异常时返回503
+func (L *Letsgo) ReadyzHandler() echo.HandlerFunc {
+	h := L.health()
+	return func(c echo.Context) error {
+		report := h.Run(c.Request().Context())
+		if report.Status == HealthDown {
+			return c.JSON(http.StatusServiceUnavailable, report)
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+// RegisterHealthRoutes 在echo上注册/healthz与/readyz
+func (L *Letsgo) RegisterHealthRoutes(e *echo.Echo) {
+	e.GET("/healthz", L.HealthzHandler())
+	e.GET("/readyz", L.ReadyzHandler())
+}
+
+// health 未调用InitHealth时使用默认配置
+func (L *Letsgo) health() *Health {
+	if L.Health == nil {
+		L.InitHealth()
+	}
+	return L.Health
+}
@@ -3,18 +3,20 @@ package letsgo
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"math/rand"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,6 +26,9 @@ import (
 
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/bitly/go-simplejson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HTTPQueryer 为cachehttp的接口
@@ -37,10 +42,18 @@ type HTTPQueryer interface {
 // HTTPQuery 为cachehttp的结构体
 type HTTPQuery struct {
 	CL              *http.Client
-	Cache           *Cache
+	Cache           *Cache            //默认缓存后端
+	Caches          map[string]*Cache //按名称选择的缓存后端，见HTTPQueryBuilder.SetCacheName
+	CacheLock       *CacheLock        //HTTPQueryBuilder.SetLoadLock启用时用于跨实例合并请求
 	HTTPcounter     int
 	HTTPcounterLock sync.Mutex
 	Logfile         string
+	Metrics         *Metrics
+	Tracer          trace.Tracer
+	Logger          *slog.Logger
+	dumpLog         *log.Logger //http请求响应日志，整个生命周期只打开一次
+	dumpWriter      *RotateWriter
+	dumpLock        sync.Mutex
 }
 
 // newHTTPQuery 返回一个HTTPQuery的结构体指针
@@ -68,6 +81,55 @@ func (c *HTTPQuery) Init(logfile string) {
 	c.Logfile = logfile
 }
 
+// OpenDumpLog 按Logfile打开http请求响应日志，opts为切割配置
+func (c *HTTPQuery) OpenDumpLog(opts RotateOptions) error {
+	c.dumpLock.Lock()
+	defer c.dumpLock.Unlock()
+	return c.openDumpLog(opts)
+}
+
+func (c *HTTPQuery) openDumpLog(opts RotateOptions) error {
+	if c.dumpWriter != nil {
+		return nil
+	}
+	writer, err := NewRotateWriter(c.Logfile, opts)
+	if err != nil {
+		return err
+	}
+	c.dumpWriter = writer
+	c.dumpLog = log.New(writer, "\n[Letsgo-cacheHTTP] ", log.LstdFlags)
+	return nil
+}
+
+// dumpLogger 返回http请求响应日志，未通过OpenDumpLog打开时按默认配置打开，Logfile为空返回nil
+func (c *HTTPQuery) dumpLogger() *log.Logger {
+	if c.Logfile == "" {
+		return nil
+	}
+	c.dumpLock.Lock()
+	defer c.dumpLock.Unlock()
+	if c.dumpLog == nil {
+		if err := c.openDumpLog(RotateOptions{}); err != nil {
+			loggerOr(c.Logger).Error("CacheHTTP open dump log", slog.String("file", c.Logfile), slog.Any("error", err))
+			return nil
+		}
+	}
+	return c.dumpLog
+}
+
+// CloseDumpLog 关闭http请求响应日志
+func (c *HTTPQuery) CloseDumpLog() error {
+	c.dumpLock.Lock()
+	defer c.dumpLock.Unlock()
+	if c.dumpWriter == nil {
+		return nil
+	}
+	err := c.dumpWriter.Close()
+	c.dumpWriter = nil
+	c.dumpLog = nil
+	return err
+}
+
 // SetCache 设置cache
 func (c *HTTPQuery) SetCache(cache *Cache) {
 	c.Cache = cache
@@ -87,6 +149,13 @@ func (c *HTTPQuery) SubCounter() {
 	c.HTTPcounter--
 }
 
+// GetCounter 读取内置计数器，即在途数量
+func (c *HTTPQuery) GetCounter() int {
+	c.HTTPcounterLock.Lock()
+	defer c.HTTPcounterLock.Unlock()
+	return c.HTTPcounter
+}
+
 // RandNum 在指定范围随机输出数字
 func RandNum(ran int) int {
 	t := time.Now().UnixNano()
@@ -106,17 +175,9 @@ func (c *HTTPQuery) GenUniqID() string {
 
 // SampleHTTPQuery 定义client
 func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan HTTPResponseResult) error {
+	logger := loggerOr(c.Logger)
 	//如果http请求响应日志有定义
-	httpLog := new(log.Logger)
-	if c.Logfile != "" {
-		//定义一个文件
-		logFile, err := os.OpenFile(c.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-		defer logFile.Close()
-		if err != nil {
-			log.Fatalln("open file error !")
-		}
-		httpLog = log.New(logFile, "\n[Letsgo-cacheHTTP] ", log.LstdFlags)
-	}
+	httpLog := c.dumpLogger()
 
 	var pbody io.Reader
 	httpRes := HTTPResponseResult{}
@@ -146,7 +207,7 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 					fw, err := w.CreateFormFile(filename, "file")
 					if err != nil {
 						debug.Add(fmt.Sprintf("CacheHTTP multipart create error: %s", err.Error()))
-						log.Println("[error]CacheHTTP multipart create error:", err.Error())
+						logger.Error("CacheHTTP multipart create", slog.Any("error", err))
 						return err
 					}
 					file := v.(*multipart.FileHeader)
@@ -154,24 +215,24 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 					defer fs.Close()
 					if err != nil {
 						debug.Add(fmt.Sprintf("CacheHTTP multipart open error: %s", err.Error()))
-						log.Println("[error]CacheHTTP multipart open error:", err.Error())
+						logger.Error("CacheHTTP multipart open", slog.Any("error", err))
 						return err
 					}
 					if _, err := io.Copy(fw, fs); err != nil {
 						debug.Add(fmt.Sprintf("CacheHTTP multipart io.Copy error: %s", err.Error()))
-						log.Println("[error]CacheHTTP multipart io.Copy error:", err.Error())
+						logger.Error("CacheHTTP multipart io.Copy", slog.Any("error", err))
 						return err
 					}
 				} else {
 					fw, err := w.CreateFormField(k)
 					if err != nil {
 						debug.Add(fmt.Sprintf("CacheHTTP multipart create error: %s", err.Error()))
-						log.Println("[error]CacheHTTP multipart create error:", err.Error())
+						logger.Error("CacheHTTP multipart create", slog.Any("error", err))
 						return err
 					}
 					if _, err = fw.Write([]byte(v.(string))); err != nil {
 						debug.Add(fmt.Sprintf("CacheHTTP multipart write error: %s", err.Error()))
-						log.Println("[error]CacheHTTP multipart write error:", err.Error())
+						logger.Error("CacheHTTP multipart write", slog.Any("error", err))
 						return err
 					}
 				}
@@ -185,9 +246,19 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		}
 	}
 
-	req, err := http.NewRequest(rq.Method, rq.URL, pbody)
+	ctx, span := startSpan(c.Tracer, rq.ctx, "http.query "+rq.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", rq.Method), attribute.String("url.full", rq.URL)))
+	var spanOnce sync.Once
+	finishSpan := func(err error) {
+		spanOnce.Do(func() { endSpan(span, err) })
+	}
+	defer finishSpan(nil)
+
+	req, err := http.NewRequestWithContext(ctx, rq.Method, rq.URL, pbody)
 	if err != nil {
-		log.Println("[error]CacheHTTP gen newRequest:", err.Error())
+		logger.Error("CacheHTTP gen newRequest", slog.String("url", rq.URL), slog.Any("error", err))
+		finishSpan(err)
+		return err
 	}
 	//增加header
 	req.Header.Add("User-Agent", "Mozilla/5.0")
@@ -204,14 +275,17 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		req.Header.Set(k, v)
 	}
 
+	//注入W3C traceparent
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	debug.Add(fmt.Sprintf("Send HTTP Query: %s", rq.URL))
 	start := time.Now()
 
 	//原始http请求
-	if c.Logfile != "" {
+	if httpLog != nil {
 		requestDump, err := httputil.DumpRequest(req, true)
 		if err != nil {
-			fmt.Println(err)
+			logger.Warn("CacheHTTP dump request", slog.Any("error", err))
 		}
 		httpLog.Println("\n---Request---\n" + string(requestDump))
 	}
@@ -231,16 +305,28 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		resp, err := c.CL.Do(req)
 		end := time.Since(start)
 		debug.Add(fmt.Sprintf("HTTP Time Cost: %f ms", end.Seconds()*1000))
+		if err != nil {
+			c.Metrics.ObserveHTTPQuery(rq.URL, 0, start)
+			finishSpan(err)
+		} else {
+			c.Metrics.ObserveHTTPQuery(rq.URL, resp.StatusCode, start)
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			if resp.StatusCode >= 400 {
+				finishSpan(fmt.Errorf("http status %d", resp.StatusCode))
+			} else {
+				finishSpan(nil)
+			}
+		}
 		if err != nil {
 			//不抛出错误而是接口降级
 			debug.Add(fmt.Sprintf("HTTP Query Downgrade: %s", err.Error()))
-			log.Println("[error]CacheHTTP request error:", err.Error())
+			logger.Error("CacheHTTP request", slog.String("url", rq.URL), slog.Any("error", err))
 			return err
 		}
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
 			// //不抛出错误而是接口降级
 			debug.Add(fmt.Sprintf("HTTP Query Downgrade: non-200 StatusCode:%s", rq.URL))
-			log.Println("[error]CacheHTTP request got non-200 StatusCode:", rq.URL)
+			logger.Warn("CacheHTTP request got non-200 StatusCode", slog.String("url", rq.URL), slog.Int("status", resp.StatusCode))
 
 			httpRes.ResponseStatus = -1
 		} else {
@@ -250,10 +336,10 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		defer resp.Body.Close()
 
 		//原始http响应体
-		if c.Logfile != "" {
+		if httpLog != nil {
 			responseDump, err := httputil.DumpResponse(resp, true)
 			if err != nil {
-				fmt.Println(err)
+				logger.Warn("CacheHTTP dump response", slog.Any("error", err))
 			}
 			httpLog.Println("\n---Response---\n" + string(responseDump))
 		}
@@ -266,28 +352,18 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		var body []byte
 		switch resp.Header.Get("Content-Encoding") {
 		case "gzip":
-			reader, err := gzip.NewReader(resp.Body)
-			if err != nil {
-				log.Panicln("[error]CacheHTTP read response:", err.Error())
-			}
-			for {
-				buf := make([]byte, 1024)
-				n, err := reader.Read(buf)
-
-				if err != nil && err != io.EOF {
-					panic(err)
-				}
-
-				if n == 0 {
-					break
-				}
-				body = append(body, buf...)
+			var reader *gzip.Reader
+			if reader, err = gzip.NewReader(resp.Body); err == nil {
+				body, err = io.ReadAll(reader)
 			}
 		default:
 			body, err = io.ReadAll(resp.Body)
-			if err != nil {
-				log.Panicln("[error]CacheHTTP read response:", err.Error())
-			}
+		}
+		if err != nil {
+			//读取响应失败同样接口降级，不在协程中panic
+			debug.Add(fmt.Sprintf("HTTP Query Downgrade: read response: %s", err.Error()))
+			logger.Error("CacheHTTP read response", slog.String("url", rq.URL), slog.Any("error", err))
+			return err
 		}
 
 		httpRes.HTTPStatus = resp.Status
@@ -300,7 +376,8 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 		return nil
 
 	}, func(err error) error {
-		log.Println("[error]hystrix fallback")
+		finishSpan(err)
+		logger.Error("CacheHTTP hystrix fallback", slog.String("url", rq.URL), slog.Any("error", err))
 		//放入redis重试池
 		type RedisHTTPRetryPool struct {
 			Request    HTTPRequest
@@ -309,15 +386,92 @@ func (c *HTTPQuery) SampleHTTPQuery(rq HTTPRequest, debug *DebugInfo, ret chan H
 
 		_, errcache := c.Cache.LPUSH("http_retry_pool", RedisHTTPRetryPool{Request: rq})
 		if errcache != nil {
-			println(errcache.Error())
+			logger.Error("CacheHTTP push http_retry_pool", slog.Any("error", errcache))
 		}
-		ret <- httpRes
+		//降级结果标记为失败，超时降级时请求协程可能仍在写httpRes，这里使用新的结果
+		ret <- HTTPResponseResult{UniqID: rq.UniqID, URL: rq.URL, ResponseStatus: -1}
 		return nil
 	})
 
 	return nil
 }
 
+// httpDowngradeError 接口降级时loader返回的错误，携带降级响应，不写入GetOrLoad的缓存
+type httpDowngradeError struct {
+	res HTTPResponseResult
+}
+
+func (e *httpDowngradeError) Error() string {
+	return "http query downgrade: " + e.res.URL
+}
+
+// sampleHTTPWorker 不使用缓存的请求工人，结束时减少在途计数
+func (c *HTTPQuery) sampleHTTPWorker(rq HTTPRequest, debug *DebugInfo, ret chan HTTPResponseResult) {
+	defer c.SubCounter()
+	c.SampleHTTPQuery(rq, debug, ret)
+}
+
+// loadHTTPQuery 读取缓存，未命中时发出请求并写入缓存，结果发送到ret，结束时减少在途计数
+func (c *HTTPQuery) loadHTTPQuery(cache *Cache, rq HTTPRequest, cachekey string, expire int32, debug *DebugInfo, ret chan HTTPResponseResult, opts []CacheOption) {
+	defer c.SubCounter()
+	var body []byte
+	loaded := false
+	isget, err := cache.GetOrLoad(cachekey, &body, expire, func(ctx context.Context, dst interface{}) (bool, error) {
+		querydebug := debug
+		if dst == &body {
+			loaded = true
+			debug.Add(fmt.Sprintf("Cache Miss: %s", cachekey))
+		} else {
+			//异步刷新时dst为新创建的值，请求已结束，不再使用请求的DebugInfo
+			querydebug = NewDebugInfo()
+		}
+		req := rq
+		req.ctx = ctx
+		res, err := c.queryOnce(req, querydebug)
+		if err != nil {
+			return false, err
+		}
+		if res.ResponseStatus == -1 {
+			return false, &httpDowngradeError{res: res}
+		}
+		*dst.(*[]byte) = res.Body
+		return true, nil
+	}, opts...)
+
+	var downgrade *httpDowngradeError
+	switch {
+	case errors.As(err, &downgrade):
+		ret <- downgrade.res
+	case err != nil:
+		ret <- HTTPResponseResult{UniqID: rq.UniqID, URL: rq.URL, err: err}
+	case !isget:
+		ret <- HTTPResponseResult{UniqID: rq.UniqID, URL: rq.URL, ResponseStatus: -1}
+	default:
+		if loaded {
+			debug.Add(fmt.Sprintf("Cache Set: %s TTL: %d", cachekey, expire))
+		} else {
+			debug.Add(fmt.Sprintf("Cache Get: %s", cachekey))
+		}
+		ret <- HTTPResponseResult{UniqID: rq.UniqID, URL: rq.URL, Body: body}
+	}
+}
+
+// queryOnce 同步发出一次请求并返回响应
+func (c *HTTPQuery) queryOnce(rq HTTPRequest, debug *DebugInfo) (HTTPResponseResult, error) {
+	//hystrix超时后请求仍可能返回，缓冲区需容纳降级与实际两个结果
+	ret := make(chan HTTPResponseResult, 2)
+	err := c.SampleHTTPQuery(rq, debug, ret)
+	select {
+	case res := <-ret:
+		return res, nil
+	default:
+		if err == nil {
+			err = fmt.Errorf("no response")
+		}
+		return HTTPResponseResult{}, fmt.Errorf("[error]CacheHTTP request %s: %w", rq.URL, err)
+	}
+}
+
 // Run 执行方法,支持http多协程请求并缓存
 func (c *HTTPQuery) Run(cher HTTPQueryer) (map[string]interface{}, error) {
 	type CacheData struct {
@@ -338,7 +492,11 @@ func (c *HTTPQuery) Run(cher HTTPQueryer) (map[string]interface{}, error) {
 
 	debug := cher.GetDebugInfo()
 
-	debug.Add(c.Cache.Show())
+	cache, err := cacheFor(c.Cache, c.Caches, ch.CacheName)
+	if err != nil {
+		return nil, fmt.Errorf("[error]CacheHTTP select cache:%s %s", err.Error(), UNIQID)
+	}
+	debug.Add(cache.Show())
 
 	var NeedHTTPSum int
 	for _, eachhttp := range ch.Requests {
@@ -347,44 +505,43 @@ func (c *HTTPQuery) Run(cher HTTPQueryer) (map[string]interface{}, error) {
 			eachhttp.Header = make(map[string]string)
 		}
 		eachhttp.Header["User-Agent"] = "Letsgo-HTTP-Agent"
+		eachhttp.ctx = ch.CommonParams.GetContext()
 
 		cachekey := "HTTP_" + eachhttp.UniqID
-		var retdata []byte
 		if eachhttp.NeedCache {
-			if isget, err := c.Cache.Get(cachekey, &retdata); isget != true { //cache miss or error
-				if err != nil {
-					return nil, fmt.Errorf("[error]CacheHTTP get cache:%s %s", err.Error(), UNIQID)
-				}
-
-				debug.Add(fmt.Sprintf("Cache Miss: %s", cachekey))
-				//debug.Add(fmt.Sprintf("CacheHTTP UniqID: %s", uniqid))
-
-				go c.SampleHTTPQuery(eachhttp, debug, ch.ResponseCH)
-				c.AddCounter()
-				AllCacheData[eachhttp.UniqID] = CacheData{NeedCache: eachhttp.NeedCache, CacheKey: cachekey, Rtype: eachhttp.Rtype, HTTPError: false, Cachedata: nil}
-				NeedHTTPSum++
-			} else { //get cache
-				debug.Add(fmt.Sprintf("Cache Get: %s", cachekey))
-				AllCacheData[eachhttp.UniqID] = CacheData{NeedCache: false, CacheKey: cachekey, Rtype: eachhttp.Rtype, HTTPError: false, Cachedata: retdata}
-			}
+			//缓存读取与未命中时的请求均在goroutine中进行，同一key的并发请求只发出一次
+			c.AddCounter()
+			go c.loadHTTPQuery(cache, eachhttp, cachekey, expire, debug, ch.ResponseCH, loadOptions(ch.CommonParams.GetContext(), c.CacheLock, ch.LoadLock, ch.SoftExpireTime))
+			AllCacheData[eachhttp.UniqID] = CacheData{NeedCache: false, CacheKey: cachekey, Rtype: eachhttp.Rtype, HTTPError: false, Cachedata: nil}
+			NeedHTTPSum++
 		} else {
 			//goroutine http
-			go c.SampleHTTPQuery(eachhttp, debug, ch.ResponseCH)
 			c.AddCounter()
+			go c.sampleHTTPWorker(eachhttp, debug, ch.ResponseCH)
 			AllCacheData[eachhttp.UniqID] = CacheData{NeedCache: eachhttp.NeedCache, CacheKey: "", Rtype: eachhttp.Rtype, HTTPError: false, Cachedata: nil}
 			NeedHTTPSum++
 		}
 	}
 
+	//加载失败时记录第一个错误并继续接收，避免其余请求的结果无人读取
+	var loaderr error
 	for NeedHTTPSum > 0 {
 		select {
 		case i, ok := <-ch.ResponseCH:
 			if ok {
 				//fmt.Println("CacheHTTP channel receive data:", string(i.Body))
+				if i.err != nil {
+					if loaderr == nil {
+						loaderr = i.err
+					}
+					break
+				}
 				data := AllCacheData[i.UniqID]
 				data.Cachedata = i.Body
 				if i.ResponseStatus == -1 {
 					data.HTTPError = true
+					//降级结果未由GetOrLoad写入缓存，使用较短的TTL缓存
+					data.NeedCache = data.CacheKey != ""
 				}
 				AllCacheData[i.UniqID] = data
 			} else {
@@ -394,7 +551,9 @@ func (c *HTTPQuery) Run(cher HTTPQueryer) (map[string]interface{}, error) {
 			return nil, fmt.Errorf("[error]CacheHTTP channel timeout after %d second: %s", config.CACHEHTTP_SELECT_TIMEOUT, UNIQID)
 		}
 		NeedHTTPSum--
-		c.SubCounter()
+	}
+	if loaderr != nil {
+		return nil, fmt.Errorf("[error]CacheHTTP load:%s %s", loaderr.Error(), UNIQID)
 	}
 
 	retdata := make(map[string]interface{}) // key:UniqID value:interface{}
@@ -406,7 +565,7 @@ func (c *HTTPQuery) Run(cher HTTPQueryer) (map[string]interface{}, error) {
 				cacheexpire = config.CACHEHTTP_DOWNGRADE_CACHE_EXPIRE
 			}
 
-			err := c.Cache.Set(cachedata.CacheKey, &cachedata.Cachedata, cacheexpire)
+			err := cache.Set(cachedata.CacheKey, &cachedata.Cachedata, cacheexpire, WithContext(ch.CommonParams.GetContext()))
 			if err != nil {
 				return nil, fmt.Errorf("[error]CacheHTTP set cache:%s %s", err.Error(), UNIQID)
 			}
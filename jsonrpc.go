@@ -2,10 +2,13 @@ package letsgo
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //RPCconfig rpc服务器配置结构体
@@ -17,8 +20,11 @@ type RPCconfig struct {
 
 //JSONRPCClient 结构体
 type JSONRPCClient struct {
-	Service map[string]RPCconfig
-	Lock    sync.Mutex
+	Service            map[string]RPCconfig
+	Lock               sync.Mutex
+	MicroserviceClient MicroserviceClienter //用于服务发现，可以为nil
+	Tracer             trace.Tracer
+	Logger             *slog.Logger
 }
 
 //NewJSONRPCClient 返回一个JSONRPCClient结构体指针
@@ -39,9 +45,24 @@ func (c *JSONRPCClient) Set(service, network, address, microservice_name string)
 	return nil
 }
 
+//SetMicroserviceClient 设置用于服务发现的微服务客户端
+func (c *JSONRPCClient) SetMicroserviceClient(client MicroserviceClienter) {
+	c.Lock.Lock()
+	c.MicroserviceClient = client
+	c.Lock.Unlock()
+}
+
+//lookup 读取service配置及微服务客户端
+func (c *JSONRPCClient) lookup(service string) (RPCconfig, MicroserviceClienter, bool) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	thisservice, ok := c.Service[service]
+	return thisservice, c.MicroserviceClient, ok
+}
+
 //Dial 连接到一个rpc服务器
 func (c *JSONRPCClient) Dial(service string) (*rpc.Client, error) {
-	thisservice, ok := c.Service[service]
+	thisservice, msclient, ok := c.lookup(service)
 	if !ok {
 		return nil, fmt.Errorf("[error]jsonrpc Call unknown service: %s", service)
 	}
@@ -50,13 +71,13 @@ func (c *JSONRPCClient) Dial(service string) (*rpc.Client, error) {
 
 	if thisservice.Address != "" {
 		addr = thisservice.Address
-	} else if Default.MicroserviceClient != nil && Default.MicroserviceClient.IsActive() { //不填写传统地址才使用服务发现
+	} else if msclient != nil && msclient.IsActive() { //不填写传统地址才使用服务发现
 		var err error
-		addr, err = Default.MicroserviceClient.ServiceDiscovery(thisservice.MicroserviceName)
+		addr, err = msclient.ServiceDiscovery(thisservice.MicroserviceName)
 		if err != nil {
 			return nil, fmt.Errorf("[error]jsonrpc ServiceDiscovery error: %s", err.Error())
 		}
-		log.Println("dial use microservice discovery, addr:", addr)
+		loggerOr(c.Logger).Debug("jsonrpc dial use microservice discovery", slog.String("service", service), slog.String("addr", addr))
 	} else {
 		return nil, fmt.Errorf("[error]jsonrpc addr empty")
 	}
@@ -71,22 +92,22 @@ func (c *JSONRPCClient) Dial(service string) (*rpc.Client, error) {
 
 //DialWithMicroserviceFind 使用微服务发现并连接到rpc服务器
 func (c *JSONRPCClient) DialWithServiceDiscovery(service string) (*rpc.Client, error) {
-	thisservice, ok := c.Service[service]
+	thisservice, msclient, ok := c.lookup(service)
 	if !ok {
 		return nil, fmt.Errorf("[error]jsonrpc Call unknown service: %s", service)
 	}
 
-	if Default.MicroserviceClient == nil {
+	if msclient == nil {
 		return nil, fmt.Errorf("[error]jsonrpc need init MicroserviceClient")
 	}
 
-	if !Default.MicroserviceClient.IsActive() {
+	if !msclient.IsActive() {
 		return nil, fmt.Errorf("[error]jsonrpc need active MicroserviceClient")
 	}
 
-	addr, err := Default.MicroserviceClient.ServiceDiscovery(thisservice.MicroserviceName)
+	addr, err := msclient.ServiceDiscovery(thisservice.MicroserviceName)
 	if err != nil {
-		return nil, fmt.Errorf("[error]jsonrpc ServiceDiscovery error:", err.Error())
+		return nil, fmt.Errorf("[error]jsonrpc ServiceDiscovery error: %s", err.Error())
 	}
 
 	client, err := jsonrpc.Dial(thisservice.Network, addr)
@@ -96,3 +117,21 @@ func (c *JSONRPCClient) DialWithServiceDiscovery(service string) (*rpc.Client, e
 
 	return client, nil
 }
+
+//Call 连接到service并调用serviceMethod，commp携带链路时创建rpc子span
+func (c *JSONRPCClient) Call(commp *CommonParams, service string, serviceMethod string, args interface{}, reply interface{}) (err error) {
+	_, span := startSpan(c.Tracer, commp.GetContext(), "rpc.call "+serviceMethod, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.service", service), attribute.String("rpc.method", serviceMethod)))
+	defer func() { endSpan(span, err) }()
+
+	client, err := c.Dial(service)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.Call(serviceMethod, args, reply); err != nil {
+		return fmt.Errorf("[error]jsonrpc call %s: %s", serviceMethod, err.Error())
+	}
+	return nil
+}
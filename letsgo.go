@@ -1,9 +1,13 @@
 package letsgo
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -20,6 +24,8 @@ type CommonParams struct {
 	HTTPContext echo.Context
 	Params      map[string]string
 	Debug       *DebugInfo
+	Ctx         context.Context //携带链路追踪信息
+	logger      *slog.Logger
 }
 
 // Init 初始化
@@ -34,6 +40,14 @@ func (commp *CommonParams) SetParam(name string, value string) bool {
 	return true
 }
 
+// GetContext 返回携带链路追踪信息的context，未设置时返回context.Background()
+func (commp *CommonParams) GetContext() context.Context {
+	if commp == nil || commp.Ctx == nil {
+		return context.Background()
+	}
+	return commp.Ctx
+}
+
 // GetParam 读出参数
 func (commp *CommonParams) GetParam(name string) string {
 	v, ok := commp.Params[name]
@@ -46,22 +60,53 @@ func (commp *CommonParams) GetParam(name string) string {
 // Letsgo 框架依赖功能结构体
 type Letsgo struct {
 	DBC
-	Cache              *Cache
+	Cache              *Cache            //默认缓存后端
+	Caches             map[string]*Cache //按名称注册的全部缓存后端
 	CacheLock          *CacheLock
 	DBQuery            *DBQuery
 	HTTPQuery          *HTTPQuery
 	JSONRPCClient      *JSONRPCClient
 	Schedules          *Schedule
-	Logger             *log.Logger
-	LoggerFile         *os.File
+	Logger             *log.Logger //兼容旧代码，InitLog后与Log写入同一输出
+	LoggerFile         *os.File    //已废弃，InitLog改为使用LogWriter
+	LogWriter          *RotateWriter
+	Log                *slog.Logger
+	LogLevel           *slog.LevelVar
+	LogOptions         LogOptions //InitLog及InitSlog使用的日志配置
 	ContextSet         contextSet
 	MicroserviceClient MicroserviceClienter
 	SSE                *SSE
+	Health             *Health
+	Shutdown           *ShutdownCoordinator
+	Config             *ConfigSet
+	Metrics            *Metrics
+	Tracing            *Tracing
+	Echo               *echo.Echo      //GET/POST等路由注册使用的echo，可在Serve前自定义
+	ServerOptions      ServerOptions   //Serve使用的服务端配置
+	SentinelOptions    SentinelOptions //RedisType为3时InitRedis使用的sentinel配置
+	StartupRetry       map[string]RetryPolicy
+	StartupContext     context.Context //取消时中断启动重试的等待，为空时不可中断，InitFromConfig期间收到SIGTERM/SIGINT时取消
+	initOrder          []string
+	initLock           sync.Mutex
+	hupWriters         []*RotateWriter
+	hupStop            chan struct{}
+	hupLock            sync.Mutex
+	echoLock           sync.Mutex
+	serveOnce          sync.Once //Serve的中间件只安装一次
+	cacheLock          sync.Mutex
+	workers            []worker
+	workerLock         sync.Mutex
 }
 
-// NewLetsgo 返回一个Letsgo类型的结构体指针
-func NewLetsgo() {
-	Default = &Letsgo{}
+// New 返回一个独立的Letsgo类型的结构体指针，不影响Default
+func New() *Letsgo {
+	return &Letsgo{}
+}
+
+// NewLetsgo 返回一个Letsgo类型的结构体指针，同时设置为Default
+func NewLetsgo() *Letsgo {
+	Default = New()
+	return Default
 }
 
 // Init 初始化框架
@@ -75,111 +120,220 @@ func (L *Letsgo) Init() {
 	hystrix.ConfigureCommand(config.HYSTRIX_DEFAULT_TAG, config.HYSTRIX_DEFAULT_CONFIG)
 }
 
-// InitDBQuery 初始化DBQuery
+// InitDBQuery 初始化DBQuery，失败时panic
 func (L *Letsgo) InitDBQuery(cfg config.DBconfigStruct) {
+	if err := L.InitDBQueryE(cfg); err != nil {
+		log.Panicf("[error]Databases: %s", err.Error())
+	}
+}
+
+// InitDBQueryE 初始化DBQuery，按启动重试策略连接每个数据库，失败时关闭已建立的连接并返回错误
+func (L *Letsgo) InitDBQueryE(cfg config.DBconfigStruct) error {
 	//db init
-	L.DBC = make(map[string]DBSet)
-	L.DBQuery = newDBQuery()
+	dbc := make(map[string]DBSet)
 
 	for k, v := range cfg {
-		var err error
 		DBset := DBSet{Master: nil, Slave: nil}
 
-		//init Master
-		DBset.Master, err = sql.Open("mysql", v["master"].DBusername+":"+v["master"].DBpassword+"@tcp("+v["master"].DBhostsip+")/"+v["master"].DBname+"?charset="+v["master"].DBcharset)
-		if err != nil {
-			log.Panicf("[error]Databases: connect error: %s", err.Error())
-		}
-		DBset.Master.SetMaxOpenConns(v["master"].DBconnMaxConns)
-		DBset.Master.SetMaxIdleConns(v["master"].DBconnMaxIdles)
-		DBset.Master.SetConnMaxLifetime(v["master"].DBconnMaxLifeTime)
-		err = DBset.Master.Ping()
-		if err != nil {
-			log.Panicf("[error]Databases: connect error: %s", err.Error())
-		}
-
-		//init slave
-		//判断是否是主从集群
-		if v["slave"] != (config.DBconfig{}) {
-			DBset.Slave, err = sql.Open("mysql", v["slave"].DBusername+":"+v["slave"].DBpassword+"@tcp("+v["slave"].DBhostsip+")/"+v["slave"].DBname+"?charset="+v["slave"].DBcharset)
+		err := L.withStartupRetry(DependencyDB, func() error {
+			var err error
+			//init Master
+			DBset.Master, err = openDB(v["master"])
 			if err != nil {
-				log.Panicf("[error]Databases: connect error: %s", err.Error())
+				return fmt.Errorf("'%s' master: %w", k, err)
 			}
-			DBset.Slave.SetMaxOpenConns(v["slave"].DBconnMaxConns)
-			DBset.Slave.SetMaxIdleConns(v["slave"].DBconnMaxIdles)
-			DBset.Master.SetConnMaxLifetime(v["slave"].DBconnMaxLifeTime)
-			err = DBset.Slave.Ping()
-			if err != nil {
-				log.Panicf("[error]Databases: connect error: %s", err.Error())
+
+			//init slave
+			//判断是否是主从集群
+			if v["slave"] != (config.DBconfig{}) {
+				DBset.Slave, err = openDB(v["slave"])
+				if err != nil {
+					DBset.Master.Close()
+					return fmt.Errorf("'%s' slave: %w", k, err)
+				}
 			}
-		} else {
-			DBset.Slave = nil
+			return nil
+		})
+		if err != nil {
+			closeDBC(dbc)
+			return err
 		}
 
 		//finally assign
-		L.DBC[k] = DBset
+		dbc[k] = DBset
 	}
 
+	L.DBC = dbc
+	L.DBQuery = newDBQuery()
 	L.DBQuery.SetDBset(L.DBC)
 	L.DBQuery.SetCache(L.Cache)
+	L.markInit(resourceDB)
+	L.wireSubsystems()
+	return nil
+}
 
+// openDB 打开并ping一个mysql连接池
+func openDB(cfg config.DBconfig) (*sql.DB, error) {
+	db, err := sql.Open("mysql", cfg.DBusername+":"+cfg.DBpassword+"@tcp("+cfg.DBhostsip+")/"+cfg.DBname+"?charset="+cfg.DBcharset)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBconnMaxConns)
+	db.SetMaxIdleConns(cfg.DBconnMaxIdles)
+	db.SetConnMaxLifetime(cfg.DBconnMaxLifeTime)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-// InitMemcached 初始化memcached
+// closeDBC 关闭DBC中所有连接池
+func closeDBC(dbc DBC) {
+	for _, v := range dbc {
+		v.Master.Close()
+		//判断是否是主从集群
+		if v.Slave != nil {
+			v.Slave.Close()
+		}
+	}
+}
+
+// InitMemcached 初始化memcached，注册为名为memcached的缓存后端
 func (L *Letsgo) InitMemcached(MemcachedHost []string, MemcachedMaxIdleConns int, MemcachedMaxTimeout time.Duration) {
+	L.InitNamedMemcached(CacheMemcached, MemcachedHost, MemcachedMaxIdleConns, MemcachedMaxTimeout)
+}
+
+// InitNamedMemcached 初始化memcached并注册为名为name的缓存后端
+func (L *Letsgo) InitNamedMemcached(name string, MemcachedHost []string, MemcachedMaxIdleConns int, MemcachedMaxTimeout time.Duration) *Cache {
 	//init cache
-	L.Cache = newCache()
+	cache := newCache()
 	//memcached
-	L.Cache.Memcached = newLmemcache()
-	L.Cache.Memcached.Conn(MemcachedHost...)
-	L.Cache.Memcached.MaxIdleConns(MemcachedMaxIdleConns)
-	L.Cache.Memcached.MaxTimeout(MemcachedMaxTimeout)
-
-	L.Cache.Init()
+	cache.Memcached = newLmemcache()
+	cache.Memcached.Conn(MemcachedHost...)
+	cache.Memcached.MaxIdleConns(MemcachedMaxIdleConns)
+	cache.Memcached.MaxTimeout(MemcachedMaxTimeout)
+
+	cache.Init()
+	L.AddCache(name, cache)
+	return cache
 }
 
-// InitRedis 初始化redis, RedisType 1-standalone 2-redis cluster
+// InitRedis 初始化redis, RedisType 1-standalone 2-redis cluster 3-sentinel，失败时panic
+// sentinel模式下RedisServers[0]为主节点名称，其余为sentinel地址
 func (L *Letsgo) InitRedis(RedisType int, RedisServers []string, RedisDialOption []redis.DialOption) {
-	//init cache
-	L.Cache = newCache()
-	if RedisType == 1 {
-		L.Cache.Redis = newLredis()
-	} else {
-		L.Cache.Redis = newLredisc()
+	if err := L.InitRedisE(RedisType, RedisServers, RedisDialOption); err != nil {
+		log.Panicf("[error]RedisCluster: %s", err.Error())
+	}
+}
+
+// InitRedisE 初始化redis并注册为名为redis的缓存后端, RedisType 1-standalone 2-redis cluster 3-sentinel，按启动重试策略连接，失败时返回错误
+func (L *Letsgo) InitRedisE(RedisType int, RedisServers []string, RedisDialOption []redis.DialOption) error {
+	_, err := L.InitNamedRedisE(CacheRedis, RedisType, RedisServers, RedisDialOption)
+	return err
+}
+
+// InitNamedRedisE 初始化redis并注册为名为name的缓存后端，sentinel模式使用L.SentinelOptions
+func (L *Letsgo) InitNamedRedisE(name string, RedisType int, RedisServers []string, RedisDialOption []redis.DialOption) (*Cache, error) {
+	return L.initNamedRedisE(name, RedisType, RedisServers, RedisDialOption, L.SentinelOptions)
+}
+
+// initNamedRedisE 初始化redis并注册为名为name的缓存后端，sentinel为sentinel模式的配置
+func (L *Letsgo) initNamedRedisE(name string, RedisType int, RedisServers []string, RedisDialOption []redis.DialOption, sentinel SentinelOptions) (*Cache, error) {
+	if len(RedisServers) == 0 {
+		return nil, &InitError{Dependency: DependencyRedis, Attempts: 0, Err: fmt.Errorf("redis servers empty")}
 	}
-	err := L.Cache.Redis.Init(RedisServers, RedisDialOption)
+	//init cache
+	cache := newCache()
+	err := L.withStartupRetry(DependencyRedis, func() error {
+		switch RedisType {
+		case 1:
+			cache.Redis = newLredis()
+		case 3:
+			sentinelRedis := newLredissentinel(sentinel)
+			sentinelRedis.Logger = L.Log
+			cache.Redis = sentinelRedis
+		default:
+			clusterRedis := newLredisc()
+			clusterRedis.Logger = L.Log
+			cache.Redis = clusterRedis
+		}
+		if err := cache.Redis.Init(RedisServers, RedisDialOption); err != nil {
+			//关闭初始化失败的客户端，避免每次重试遗留连接池与sentinel监听
+			cache.Redis.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		log.Panicf("[error]RedisCluster: %s", err.Error())
+		return nil, err
 	}
 
-	L.Cache.Init()
+	cache.Init()
+	L.AddCache(name, cache)
+	return cache, nil
 }
 
-// InitHTTPQuery 初始化http
+// InitHTTPQuery 初始化http，失败时panic
 func (L *Letsgo) InitHTTPQuery(HTTPLog string) {
+	if err := L.InitHTTPQueryE(HTTPLog); err != nil {
+		log.Panicf("%s", err.Error())
+	}
+}
+
+// InitHTTPQueryE 初始化http，cache未初始化时返回错误
+func (L *Letsgo) InitHTTPQueryE(HTTPLog string) error {
+	if L.Cache == nil || L.Cache.UseRedisOrMemcached == 0 {
+		return &InitError{Dependency: DependencyHTTPQuery, Attempts: 0, Err: fmt.Errorf("HTTP use cache but cache doesn't init")}
+	}
 	//init HTTPQuery
 	L.HTTPQuery = newHTTPQuery()
-	if L.Cache.UseRedisOrMemcached == 0 {
-		log.Panicf("[error]HTTP use cache but cache doesn't init")
-	}
 	L.HTTPQuery.SetCache(L.Cache)
 	L.HTTPQuery.Init(HTTPLog)
+	L.wireSubsystems()
+	if HTTPLog != "" {
+		if err := L.HTTPQuery.OpenDumpLog(L.LogOptions.Rotate); err != nil {
+			return &InitError{Dependency: DependencyHTTPQuery, Attempts: 1, Err: err}
+		}
+		L.reopenOnSIGHUP(L.HTTPQuery.dumpWriter)
+		L.markInit(resourceHTTPDump)
+	}
+	return nil
 }
 
-// InitLog 初始化日志
+// InitLog 初始化日志，失败时panic
 func (L *Letsgo) InitLog(LogFileName string) {
-	logfile, err := os.OpenFile(LogFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err := L.InitLogE(LogFileName); err != nil {
+		log.Panicf("Can't open the log file %s: %s", LogFileName, err.Error())
+	}
+}
+
+// InitLogE 初始化日志，按启动重试策略打开日志文件，按LogOptions.Rotate切割，失败时返回错误
+func (L *Letsgo) InitLogE(LogFileName string) error {
+	var writer *RotateWriter
+	err := L.withStartupRetry(DependencyLog, func() error {
+		var err error
+		writer, err = NewRotateWriter(LogFileName, L.LogOptions.Rotate)
+		return err
+	})
 	if err != nil {
-		log.Panicf("Can't open the log file %s", LogFileName)
+		return err
 	}
-	L.LoggerFile = logfile
-	L.Logger = log.New(logfile, "[LetsGo Log]", log.Ldate|log.Ltime|log.Llongfile)
+	if err := L.InitSlog(writer); err != nil {
+		writer.Close()
+		return err
+	}
+	L.LogWriter = writer
+	L.reopenOnSIGHUP(writer)
+	L.markInit(resourceLog)
+	return nil
 }
 
 // InitSchedule 初始化并发器
 func (L *Letsgo) InitSchedule() {
 	L.Schedules = newSchedule()
 	L.Schedules.Init()
+	L.wireSubsystems()
 }
 
 // InitJSONRPC 初始化JSON RPC
@@ -187,25 +341,43 @@ func (L *Letsgo) InitJSONRPC(RPCConfig map[string]config.RPCconfig) {
 	//init jsonrpc
 	L.JSONRPCClient = NewJSONRPCClient()
 	L.JSONRPCClient.Init()
+	L.JSONRPCClient.SetMicroserviceClient(L.MicroserviceClient)
+	L.wireSubsystems()
 	for service, rpcconfig := range RPCConfig {
 		L.JSONRPCClient.Set(service, rpcconfig.Network, rpcconfig.Address, rpcconfig.MicroserviceName)
 	}
 }
 
-// InitMemConfig 初始化内存式配置
+// InitMemConfig 初始化内存式配置，Default实例沿用全局CONFIG_SET，其他实例使用各自的配置集
 func (L *Letsgo) InitMemConfig() {
 	//init config
-	InitConfig()
+	L.initLock.Lock()
+	defer L.initLock.Unlock()
+	if L == Default {
+		InitConfig()
+		L.Config = CONFIG_SET
+		return
+	}
+	L.Config = newConfigSet()
 }
 
-// InitCacheLock 初始化缓存锁
+// InitCacheLock 初始化缓存锁，失败时panic
 func (L *Letsgo) InitCacheLock() {
-	//init CacheLock
-	L.CacheLock = newCacheLock()
-	if L.Cache.UseRedisOrMemcached == 0 {
-		log.Panicf("[error]CacheLock use cache but cache doesn't init")
+	if err := L.InitCacheLockE(); err != nil {
+		log.Panicf("%s", err.Error())
 	}
-	L.CacheLock.Cache = L.Cache
+}
+
+// InitCacheLockE 初始化缓存锁，cache未初始化时返回错误
+func (L *Letsgo) InitCacheLockE() error {
+	if L.Cache == nil || L.Cache.UseRedisOrMemcached == 0 {
+		return &InitError{Dependency: DependencyCacheLock, Attempts: 0, Err: fmt.Errorf("CacheLock use cache but cache doesn't init")}
+	}
+	//init CacheLock，优先使用redis后端
+	L.CacheLock = newCacheLock()
+	L.CacheLock.Cache = L.redisCache()
+	L.wireSubsystems()
+	return nil
 }
 
 // InitContextSet 初始化上下文集合
@@ -216,44 +388,90 @@ func (L *Letsgo) InitContextSet() {
 
 // InitMicroServiceClient 初始化微服务框架客户端
 func (L *Letsgo) InitMicroserviceClient(client MicroserviceClienter) {
+	L.InitMicroserviceClientE(client)
+}
+
+// InitMicroserviceClientE 初始化微服务客户端并设置日志等子系统，返回client.Init的错误
+func (L *Letsgo) InitMicroserviceClientE(client MicroserviceClienter) error {
 	L.MicroserviceClient = client
-	L.MicroserviceClient.Init()
+	L.wireSubsystems()
+	if err := L.MicroserviceClient.Init(); err != nil {
+		return err
+	}
+	if L.JSONRPCClient != nil {
+		L.JSONRPCClient.SetMicroserviceClient(client)
+	}
+	return nil
 }
 
 // InitSSE 初始化http sse服务端
 func (L *Letsgo) InitHTTPSSEServer() {
 	L.SSE = newSSE()
 	L.SSE.Init()
+	L.markInit(resourceSSE)
 }
 
-// Close 关闭Letsgo框架
-func (L *Letsgo) Close() {
-	if L.DBC != nil {
-		for _, v := range L.DBC {
-			v.Master.Close()
-			//判断是否是主从集群
-			if v.Slave != nil {
-				v.Slave.Close()
-			}
+// wireSubsystems 将指标与链路追踪设置到各子系统，Init系列方法之间的先后顺序不限
+func (L *Letsgo) wireSubsystems() {
+	tracer := L.Tracing.tracer()
+	for _, cache := range L.allCaches() {
+		cache.Metrics = L.Metrics
+		cache.Tracer = tracer
+		cache.Logger = L.Log
+		switch r := cache.Redis.(type) {
+		case *Lredisc:
+			r.Logger = L.Log
+		case *Lredissentinel:
+			r.Logger = L.Log
 		}
 	}
-
-	if L.Logger != nil {
-		L.LoggerFile.Close()
+	if L.DBQuery != nil {
+		L.DBQuery.Caches = L.Caches
+		L.DBQuery.CacheLock = L.CacheLock
+		L.DBQuery.Metrics = L.Metrics
+		L.DBQuery.Tracer = tracer
+		L.DBQuery.Logger = L.Log
+	}
+	if L.HTTPQuery != nil {
+		L.HTTPQuery.Caches = L.Caches
+		L.HTTPQuery.CacheLock = L.CacheLock
+		L.HTTPQuery.Metrics = L.Metrics
+		L.HTTPQuery.Tracer = tracer
+		L.HTTPQuery.Logger = L.Log
+	}
+	if L.Schedules != nil {
+		L.Schedules.Metrics = L.Metrics
+		L.Schedules.Tracer = tracer
+		L.Schedules.Logger = L.Log
+	}
+	if L.JSONRPCClient != nil {
+		L.JSONRPCClient.Tracer = tracer
+		L.JSONRPCClient.Logger = L.Log
 	}
+	if L.CacheLock != nil {
+		L.CacheLock.Logger = L.Log
+	}
+	if consul, ok := L.MicroserviceClient.(*ConsulClient); ok {
+		consul.Logger = L.Log
+	}
+}
 
-	if L.Cache != nil && L.Cache.Redis != nil {
-		L.Cache.Redis.Close()
+// Close 关闭Letsgo框架，资源按初始化的逆序关闭，需要等待在途任务请使用Shutdown
+func (L *Letsgo) Close() {
+	if L.MicroserviceClient != nil && L.MicroserviceClient.IsDeregisterBeforeExit() {
+		L.MicroserviceClient.DeregisterAllService()
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	L.stopWorkers(ctx)
+	cancel()
+
 	if L.ContextSet != nil {
 		L.ContextSet.CancelAll()
 	}
 
-	if L.MicroserviceClient != nil && L.MicroserviceClient.IsDeregisterBeforeExit() {
-		L.MicroserviceClient.DeregisterAllService()
-	}
+	L.closeResources()
 }
 
-// Default 框架自持变量
+// Default 框架自持变量，仅为方便使用，各子系统不依赖它
 var Default *Letsgo
@@ -0,0 +1,242 @@
+package letsgo
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// LocalCacheOptions 进程内一级缓存配置
+type LocalCacheOptions struct {
+	MaxEntries        int           //最多缓存的key数量，超过后按LRU淘汰，默认10000
+	TTL               time.Duration //一级缓存最长有效期，Set写入时不超过写入的过期时间，远端读取回填时按此有效期，默认1分钟
+	Prefixes          []string      //只缓存这些前缀的key，为空时缓存全部key
+	InvalidateChannel string        //跨实例失效广播使用的redis频道，默认letsgo:cache:invalidate，设置Namespace时加上命名空间前缀
+}
+
+// LocalCache 带TTL的进程内LRU缓存，保存编码后的值以避免调用方之间共享同一对象
+type LocalCache struct {
+	Options LocalCacheOptions
+	origin  string //实例id，用于忽略自己发出的失效广播
+	ll      *list.List
+	items   map[string]*list.Element
+	lock    sync.Mutex
+}
+
+// localEntry LocalCache中的单个条目
+type localEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// newLocalCache 返回一个LocalCache结构体指针
+func newLocalCache(opts LocalCacheOptions) *LocalCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 10000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.InvalidateChannel == "" {
+		opts.InvalidateChannel = "letsgo:cache:invalidate"
+	}
+	return &LocalCache{Options: opts, origin: genRequestID(), ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Match key是否使用一级缓存
+func (l *LocalCache) Match(key string) bool {
+	if len(l.Options.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range l.Options.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 读取一级缓存中的编码值
+func (l *LocalCache) Get(key string) ([]byte, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*localEntry)
+	if time.Now().After(entry.expireAt) {
+		l.removeElement(elem)
+		return nil, false
+	}
+	l.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set 写入一级缓存，ttl超过Options.TTL时按Options.TTL计算
+func (l *LocalCache) Set(key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 || ttl > l.Options.TTL {
+		ttl = l.Options.TTL
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if elem, ok := l.items[key]; ok {
+		entry := elem.Value.(*localEntry)
+		entry.value = value
+		entry.expireAt = time.Now().Add(ttl)
+		l.ll.MoveToFront(elem)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&localEntry{key: key, value: value, expireAt: time.Now().Add(ttl)})
+	for l.ll.Len() > l.Options.MaxEntries {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+// Delete 删除一级缓存中的key
+func (l *LocalCache) Delete(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, key := range keys {
+		if elem, ok := l.items[key]; ok {
+			l.removeElement(elem)
+		}
+	}
+}
+
+// Purge 清空一级缓存
+func (l *LocalCache) Purge() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+// Len 返回一级缓存中的条目数
+func (l *LocalCache) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.ll.Len()
+}
+
+func (l *LocalCache) removeElement(elem *list.Element) {
+	l.ll.Remove(elem)
+	delete(l.items, elem.Value.(*localEntry).key)
+}
+
+// invalidate 处理一条失效广播，忽略自己发出的消息
+func (l *LocalCache) invalidate(data []byte) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	var msg invalidateMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Origin == l.origin {
+		return
+	}
+	l.Delete(msg.Keys...)
+}
+
+// invalidateMessage 跨实例失效广播消息
+type invalidateMessage struct {
+	Origin string   `json:"o"` //发送方实例id，接收方忽略自己发出的消息
+	Keys   []string `json:"k"`
+}
+
+// EnableLocalCache 在Cache前启用进程内一级缓存，使用redis时通过pub/sub在实例间广播失效，需在初始化阶段调用
+func (c *Cache) EnableLocalCache(opts LocalCacheOptions) {
+	c.DisableLocalCache()
+
+	c.localLock.Lock()
+	defer c.localLock.Unlock()
+	local := newLocalCache(opts)
+	c.Local = local
+	c.local.Store(local)
+	if c.Redis != nil {
+		//订阅在后台连接与重连，断线期间可能漏掉失效消息，重连前清空一级缓存
+		c.localSub = c.newSubscription(context.Background(), []string{c.Key(local.Options.InvalidateChannel)}, nil, func(_ context.Context, msg *PubSubMessage) {
+			local.invalidate(msg.Data)
+		})
+		c.localSub.onLost = local.Purge
+		go c.localSub.run(nil)
+	}
+}
+
+// DisableLocalCache 关闭一级缓存并停止失效广播订阅
+func (c *Cache) DisableLocalCache() {
+	c.localLock.Lock()
+	sub := c.localSub
+	c.localSub = nil
+	c.Local = nil
+	c.local.Store(nil)
+	c.localLock.Unlock()
+
+	if sub != nil {
+		sub.Close()
+	}
+}
+
+// localCache 原子读取当前的一级缓存，每次调用只读取一次并向下传递，避免与Enable/DisableLocalCache竞争
+func (c *Cache) localCache() *LocalCache {
+	return c.local.Load()
+}
+
+// useLocal 本次调用是否使用一级缓存local
+func (c *Cache) useLocal(local *LocalCache, cachekey string, o cacheOptions) bool {
+	if local == nil || o.skipLocal {
+		return false
+	}
+	return local.Match(cachekey)
+}
+
+// getLocal 从一级缓存读取并解码到DataStruct，一级缓存保存与远端相同的编码值，数据不存在的标记不解码
+func (c *Cache) getLocal(local *LocalCache, cachekey string, DataStruct interface{}, o cacheOptions) (entryMeta, bool) {
+	value, ok := local.Get(cachekey)
+	if !ok {
+		c.Metrics.ObserveCache("local", cachekey, "get", "miss")
+		return entryMeta{}, false
+	}
+	meta, _, err := unwrapMeta(value)
+	if err == nil {
+		var current bool
+		if current, err = c.tagsCurrent(meta); err == nil && !current {
+			local.Delete(cachekey)
+			c.Metrics.ObserveCache("local", cachekey, "get", "miss")
+			return entryMeta{}, false
+		}
+	}
+	if err == nil && meta.Negative {
+		c.Metrics.ObserveCache("local", cachekey, "get", "negative")
+		return meta, true
+	}
+	if err == nil {
+		err = decodeValue(value, DataStruct, c.legacyCodec(o))
+	}
+	if err != nil {
+		local.Delete(cachekey)
+		c.Metrics.ObserveCache("local", cachekey, "get", "error")
+		return entryMeta{}, false
+	}
+	c.Metrics.ObserveCache("local", cachekey, "get", "hit")
+	return meta, true
+}
+
+// broadcastInvalidate 通知其他实例删除一级缓存local中的keys
+func (c *Cache) broadcastInvalidate(local *LocalCache, keys ...string) {
+	if c.Redis == nil || local == nil {
+		return
+	}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	msg, err := json.MarshalToString(invalidateMessage{Origin: local.origin, Keys: keys})
+	if err != nil {
+		return
+	}
+	conn := c.Redis.GetConn(true)
+	defer conn.Close()
+	if _, err := conn.Do("PUBLISH", c.Key(local.Options.InvalidateChannel), msg); err != nil {
+		loggerOr(c.Logger).Warn("Cache broadcast invalidate", slog.Any("error", err))
+	}
+}
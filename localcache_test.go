@@ -0,0 +1,141 @@
+package letsgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCacheTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxTTL  time.Duration
+		ttl     time.Duration
+		wait    time.Duration
+		wantHit bool
+	}{
+		{"within ttl", time.Minute, time.Minute, 0, true},
+		{"ttl expired", time.Minute, 10 * time.Millisecond, 30 * time.Millisecond, false},
+		{"zero ttl uses max ttl", 10 * time.Millisecond, 0, 30 * time.Millisecond, false},
+		{"ttl capped by max ttl", 10 * time.Millisecond, time.Hour, 30 * time.Millisecond, false},
+		{"zero ttl within max ttl", time.Minute, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLocalCache(LocalCacheOptions{TTL: tt.maxTTL})
+			l.Set("k", []byte("v"), tt.ttl)
+			time.Sleep(tt.wait)
+			_, hit := l.Get("k")
+			if hit != tt.wantHit {
+				t.Fatalf("Get hit = %v, want %v", hit, tt.wantHit)
+			}
+			if !hit && l.Len() != 0 {
+				t.Fatalf("expired entry not removed, Len = %d", l.Len())
+			}
+		})
+	}
+}
+
+func TestLocalCacheLRU(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     func(l *LocalCache)
+		present []string
+		absent  []string
+	}{
+		{
+			name: "evicts least recently set",
+			ops: func(l *LocalCache) {
+				l.Set("a", nil, 0)
+				l.Set("b", nil, 0)
+				l.Set("c", nil, 0)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+		},
+		{
+			name: "get refreshes recency",
+			ops: func(l *LocalCache) {
+				l.Set("a", nil, 0)
+				l.Set("b", nil, 0)
+				l.Get("a")
+				l.Set("c", nil, 0)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name: "overwrite refreshes recency",
+			ops: func(l *LocalCache) {
+				l.Set("a", nil, 0)
+				l.Set("b", nil, 0)
+				l.Set("a", nil, 0)
+				l.Set("c", nil, 0)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLocalCache(LocalCacheOptions{MaxEntries: 2})
+			tt.ops(l)
+			if l.Len() != 2 {
+				t.Fatalf("Len = %d, want 2", l.Len())
+			}
+			for _, key := range tt.present {
+				if _, ok := l.Get(key); !ok {
+					t.Fatalf("%s evicted, want present", key)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := l.Get(key); ok {
+					t.Fatalf("%s present, want evicted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalCacheMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		key      string
+		want     bool
+	}{
+		{"no prefixes", nil, "user:1", true},
+		{"matching prefix", []string{"user:", "item:"}, "item:1", true},
+		{"no matching prefix", []string{"user:", "item:"}, "order:1", false},
+		{"prefix longer than key", []string{"user:"}, "user", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLocalCache(LocalCacheOptions{Prefixes: tt.prefixes})
+			if got := l.Match(tt.key); got != tt.want {
+				t.Fatalf("Match(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalCacheInvalidate(t *testing.T) {
+	l := newLocalCache(LocalCacheOptions{})
+	tests := []struct {
+		name    string
+		msg     string
+		wantHit bool
+	}{
+		{"own message ignored", `{"o":"` + l.origin + `","k":["k"]}`, true},
+		{"invalid message ignored", `{`, true},
+		{"other instance deletes", `{"o":"other","k":["k"]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.Set("k", []byte("v"), 0)
+			l.invalidate([]byte(tt.msg))
+			if _, hit := l.Get("k"); hit != tt.wantHit {
+				t.Fatalf("Get hit = %v, want %v", hit, tt.wantHit)
+			}
+		})
+	}
+}
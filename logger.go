@@ -0,0 +1,144 @@
+package letsgo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+)
+
+// 日志输出格式
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogOptions 结构化日志配置
+type LogOptions struct {
+	Level     string        //日志级别 debug info warn error，默认info
+	Format    string        //输出格式 json或text，默认json
+	AddSource bool          //是否记录调用位置
+	Rotate    RotateOptions //InitLog及http请求响应日志的切割配置
+}
+
+// ParseLogLevel 将debug/info/warn/error解析为slog.Level，空字符串视为info
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("[error]Log unknown level %s", level)
+	}
+	return l, nil
+}
+
+// newSlogHandler 根据配置返回写入w的slog.Handler，级别由levelvar控制以便运行时调整
+func newSlogHandler(w io.Writer, opts LogOptions, levelvar *slog.LevelVar) (slog.Handler, error) {
+	level, err := ParseLogLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	levelvar.Set(level)
+
+	hopts := &slog.HandlerOptions{Level: levelvar, AddSource: opts.AddSource}
+	switch strings.ToLower(opts.Format) {
+	case "", LogFormatJSON:
+		return slog.NewJSONHandler(w, hopts), nil
+	case LogFormatText:
+		return slog.NewTextHandler(w, hopts), nil
+	}
+	return nil, fmt.Errorf("[error]Log unknown format %s", opts.Format)
+}
+
+// InitSlog 使用L.LogOptions初始化写入w的结构化日志，Logger同时指向同一输出以兼容旧代码
+func (L *Letsgo) InitSlog(w io.Writer) error {
+	if L.LogLevel == nil {
+		L.LogLevel = new(slog.LevelVar)
+	}
+	handler, err := newSlogHandler(w, L.LogOptions, L.LogLevel)
+	if err != nil {
+		return err
+	}
+	L.Log = slog.New(handler)
+	L.Logger = slog.NewLogLogger(handler, slog.LevelInfo)
+	L.wireSubsystems()
+	return nil
+}
+
+// SetLogLevel 运行时调整日志级别
+func (L *Letsgo) SetLogLevel(level string) error {
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	if L.LogLevel == nil {
+		L.LogLevel = new(slog.LevelVar)
+	}
+	L.LogLevel.Set(l)
+	return nil
+}
+
+// logger 返回本实例的结构化日志，未初始化时使用slog.Default()
+func (L *Letsgo) logger() *slog.Logger {
+	return loggerOr(L.Log)
+}
+
+// loggerOr 子系统未设置日志时使用slog.Default()
+func loggerOr(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// defaultLogger 返回Default的结构化日志，用于没有Letsgo实例的包级函数
+func defaultLogger() *slog.Logger {
+	if Default != nil {
+		return Default.logger()
+	}
+	return slog.Default()
+}
+
+// Logger 返回携带request_id、pcode、did、ip字段的请求级日志
+func (commp *CommonParams) Logger() *slog.Logger {
+	if commp == nil {
+		return defaultLogger()
+	}
+	logger := commp.logger
+	if logger == nil {
+		logger = defaultLogger()
+	}
+	return logger.With(
+		slog.String("request_id", commp.GetParam("request_id")),
+		slog.String("pcode", commp.GetParam("pcode")),
+		slog.String("did", commp.GetParam("did")),
+		slog.String("ip", commp.GetParam("ip")),
+	)
+}
+
+// Recover 使用本实例日志记录panic，需以defer L.Recover()方式调用
+func (L *Letsgo) Recover() {
+	if err := recover(); err != nil {
+		logPanic(L.logger(), err)
+	}
+}
+
+// logPanic 记录panic内容及堆栈
+func logPanic(logger *slog.Logger, err interface{}) {
+	var buf [4096]byte
+	n := runtime.Stack(buf[:], false)
+	logger.Error("Letsgo panic recover", slog.String("panic", fmt.Sprint(err)), slog.String("stack", string(buf[:n])))
+}
+
+// genRequestID 生成请求id
+func genRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -34,29 +34,54 @@ func (c *Lmemcache) MaxTimeout(times time.Duration) {
 	c.mc.Timeout = times
 }
 
-//Get memcached get方法
+//Get memcached get方法，使用gob解码
 func (c *Lmemcache) Get(key string, stc interface{}) (bool, error) {
 	if key == "" || stc == nil {
 		return false, fmt.Errorf("[error]Memcache: Param invalid")
 	}
+	value, isget, err := c.GetBytes(key)
+	if !isget || err != nil {
+		return isget, err
+	}
+
+	dec := gob.NewDecoder(bytes.NewReader(value))
+	err = dec.Decode(stc)
+	if err != nil {
+		return false, fmt.Errorf("[error]Memcache decode '%s': %s", key, err.Error())
+	}
+	return true, nil
+}
+
+//GetBytes memcached get方法，返回未解码的原始值
+func (c *Lmemcache) GetBytes(key string) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, fmt.Errorf("[error]Memcache: Param invalid")
+	}
 	it, err := c.mc.Get(key)
 	if err != nil { //cache miss or error
 		if err != memcache.ErrCacheMiss {
-			return false, fmt.Errorf("[error]Memcache get '%s': %s", key, err.Error())
+			return nil, false, fmt.Errorf("[error]Memcache get '%s': %s", key, err.Error())
 		}
 
-		return false, nil //special when cache miss
+		return nil, false, nil //special when cache miss
 	}
+	return it.Value, true, nil
+}
 
-	dec := gob.NewDecoder(bytes.NewReader(it.Value))
-	err = dec.Decode(stc)
+//GetMultiBytes memcached批量get方法，返回命中key的原始值
+func (c *Lmemcache) GetMultiBytes(keys []string) (map[string][]byte, error) {
+	items, err := c.mc.GetMulti(keys)
 	if err != nil {
-		return false, fmt.Errorf("[error]Memcache decode '%s': %s", key, err.Error())
+		return nil, fmt.Errorf("[error]Memcache get multi: %s", err.Error())
 	}
-	return true, nil
+	values := make(map[string][]byte, len(items))
+	for key, it := range items {
+		values[key] = it.Value
+	}
+	return values, nil
 }
 
-//Set memcached set方法
+//Set memcached set方法，使用gob编码
 func (c *Lmemcache) Set(key string, stc interface{}, expire int32) error {
 	if key == "" || stc == nil {
 		return fmt.Errorf("[error]Memcache Param invalid")
@@ -68,14 +93,22 @@ func (c *Lmemcache) Set(key string, stc interface{}, expire int32) error {
 	if err != nil {
 		return fmt.Errorf("[error]Memcache encode '%s': %s", key, err.Error())
 	}
+	return c.SetBytes(key, buf.Bytes(), expire)
+}
+
+//SetBytes memcached set方法，直接写入已编码的值
+func (c *Lmemcache) SetBytes(key string, value []byte, expire int32) error {
+	if key == "" {
+		return fmt.Errorf("[error]Memcache Param invalid")
+	}
 
 	mcdata := &memcache.Item{
 		Key:        key,
-		Value:      buf.Bytes(),
+		Value:      value,
 		Expiration: expire,
 	}
 
-	err = c.mc.Set(mcdata)
+	err := c.mc.Set(mcdata)
 	if err != nil {
 		return fmt.Errorf("[error]Memcache set '%s': %s", key, err.Error())
 	}
@@ -90,3 +123,40 @@ func (c *Lmemcache) Delete(key string) error {
 
 	return c.mc.Delete(key)
 }
+
+//Ping 检查所有memcached服务器是否可用
+func (c *Lmemcache) Ping() error {
+	return c.mc.Ping()
+}
+
+//AddBytes memcached add方法，key已存在时不写入并返回false
+func (c *Lmemcache) AddBytes(key string, value []byte, expire int32) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("[error]Memcache Param invalid")
+	}
+
+	err := c.mc.Add(&memcache.Item{Key: key, Value: value, Expiration: expire})
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("[error]Memcache add '%s': %s", key, err.Error())
+	}
+	return true, nil
+}
+
+//Increment memcached incr方法，key不存在时返回false
+func (c *Lmemcache) Increment(key string, delta uint64) (uint64, bool, error) {
+	if key == "" {
+		return 0, false, fmt.Errorf("[error]Memcache Param invalid")
+	}
+
+	value, err := c.mc.Increment(key, delta)
+	if err == memcache.ErrCacheMiss {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("[error]Memcache incr '%s': %s", key, err.Error())
+	}
+	return value, true, nil
+}
@@ -0,0 +1,284 @@
+package letsgo
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metricCollector "github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics prometheus指标集合，每个Letsgo实例拥有独立的Registry
+// 所有方法对nil接收者安全，未初始化时不产生任何开销
+type Metrics struct {
+	Registry          *prometheus.Registry
+	DBQueryDuration   *prometheus.HistogramVec
+	CacheRequests     *prometheus.CounterVec
+	CacheCompression  *prometheus.HistogramVec
+	HTTPQueryDuration *prometheus.HistogramVec
+	ScheduleDuration  *prometheus.HistogramVec
+}
+
+// newMetrics 返回一个Metrics结构体指针并注册全部指标
+func newMetrics(L *Letsgo) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		DBQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "letsgo_db_query_duration_seconds",
+			Help:    "DBQuery latency by db name, master/slave role and operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"db", "role", "op", "result"}),
+		CacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "letsgo_cache_requests_total",
+			Help: "Cache operations by backend, key prefix, operation and result (hit, miss, ok, error).",
+		}, []string{"backend", "prefix", "op", "result"}),
+		CacheCompression: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "letsgo_cache_compression_ratio",
+			Help:    "Compressed to original size ratio of cache values over the compression threshold, values >= 1 are stored uncompressed.",
+			Buckets: []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+		}, []string{"backend", "algorithm"}),
+		HTTPQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "letsgo_http_query_duration_seconds",
+			Help:    "Outbound HTTPQuery latency by host and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"host", "status"}),
+		ScheduleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "letsgo_schedule_task_duration_seconds",
+			Help:    "Schedule worker task duration by model function.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"func"}),
+	}
+
+	m.Registry.MustRegister(
+		m.DBQueryDuration,
+		m.CacheRequests,
+		m.CacheCompression,
+		m.HTTPQueryDuration,
+		m.ScheduleDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newDBStatsCollector(L),
+		newHystrixCollector(),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "letsgo_inflight",
+			Help: "In-flight DB queries, HTTP queries and schedule workers.",
+		}, func() float64 { return float64(L.InFlight()) }),
+	)
+	return m
+}
+
+// InitMetrics 初始化prometheus指标，并接入已初始化的DB、缓存、HTTP与调度器
+func (L *Letsgo) InitMetrics() {
+	L.Metrics = newMetrics(L)
+	L.wireSubsystems()
+}
+
+// MetricsHandler 以prometheus文本格式输出指标
+func (L *Letsgo) MetricsHandler() echo.HandlerFunc {
+	if L.Metrics == nil {
+		L.InitMetrics()
+	}
+	return echo.WrapHandler(promhttp.HandlerFor(L.Metrics.Registry, promhttp.HandlerOpts{}))
+}
+
+// RegisterMetricsRoute 在echo上注册/metrics
+func (L *Letsgo) RegisterMetricsRoute(e *echo.Echo) {
+	e.GET("/metrics", L.MetricsHandler())
+}
+
+// ObserveDBQuery 记录一次DB查询耗时
+func (m *Metrics) ObserveDBQuery(db string, role string, op string, err error, start time.Time) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.DBQueryDuration.WithLabelValues(db, role, op, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache 记录一次缓存操作结果
+func (m *Metrics) ObserveCache(backend string, key string, op string, result string) {
+	if m == nil {
+		return
+	}
+	m.CacheRequests.WithLabelValues(backend, cacheKeyPrefix(key), op, result).Inc()
+}
+
+// ObserveCacheCompression 记录一次缓存值压缩的压缩率
+func (m *Metrics) ObserveCacheCompression(backend string, algorithm string, ratio float64) {
+	if m == nil {
+		return
+	}
+	m.CacheCompression.WithLabelValues(backend, algorithm).Observe(ratio)
+}
+
+// ObserveHTTPQuery 记录一次外部HTTP请求耗时，statuscode为0表示请求失败
+func (m *Metrics) ObserveHTTPQuery(rawurl string, statuscode int, start time.Time) {
+	if m == nil {
+		return
+	}
+	host := "unknown"
+	if u, err := url.Parse(rawurl); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	status := "error"
+	if statuscode != 0 {
+		status = strconv.Itoa(statuscode)
+	}
+	m.HTTPQueryDuration.WithLabelValues(host, status).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSchedule 记录一次调度任务耗时
+func (m *Metrics) ObserveSchedule(funcname string, cost time.Duration) {
+	if m == nil {
+		return
+	}
+	m.ScheduleDuration.WithLabelValues(funcname).Observe(cost.Seconds())
+}
+
+// cacheKeyPrefix 取缓存key第一个分隔符前的部分作为前缀，避免标签基数过高
+func cacheKeyPrefix(key string) string {
+	if i := strings.IndexAny(key, "_:"); i > 0 {
+		return key[:i]
+	}
+	return "none"
+}
+
+// dbStatsCollector 在抓取时读取sql.DB.Stats()
+type dbStatsCollector struct {
+	L            *Letsgo
+	openConns    *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	maxOpen      *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func newDBStatsCollector(L *Letsgo) *dbStatsCollector {
+	labels := []string{"db", "role"}
+	return &dbStatsCollector{
+		L:            L,
+		openConns:    prometheus.NewDesc("letsgo_db_pool_open_connections", "Established connections both in use and idle.", labels, nil),
+		inUse:        prometheus.NewDesc("letsgo_db_pool_in_use_connections", "Connections currently in use.", labels, nil),
+		idle:         prometheus.NewDesc("letsgo_db_pool_idle_connections", "Idle connections.", labels, nil),
+		maxOpen:      prometheus.NewDesc("letsgo_db_pool_max_open_connections", "Maximum number of open connections.", labels, nil),
+		waitCount:    prometheus.NewDesc("letsgo_db_pool_wait_count_total", "Total number of connections waited for.", labels, nil),
+		waitDuration: prometheus.NewDesc("letsgo_db_pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", labels, nil),
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConns
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.maxOpen
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+// Collect 实现prometheus.Collector
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, dbset := range c.L.DBC {
+		if dbset.Master != nil {
+			c.collect(ch, name, "master", dbset.Master.Stats())
+		}
+		if dbset.Slave != nil {
+			c.collect(ch, name, "slave", dbset.Slave.Stats())
+		}
+	}
+}
+
+func (c *dbStatsCollector) collect(ch chan<- prometheus.Metric, name string, role string, stats sql.DBStats) {
+	ch <- prometheus.MustNewConstMetric(c.openConns, prometheus.GaugeValue, float64(stats.OpenConnections), name, role)
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), name, role)
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), name, role)
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name, role)
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), name, role)
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), name, role)
+}
+
+// hystrixCircuits 记录已创建的hystrix熔断器最近一次执行观察到的状态，包级变量初始化时注册到hystrix
+var hystrixCircuits = newHystrixCircuitStates()
+
+// hystrixCircuitStates 熔断器名称到状态的映射，熔断器创建时由hystrix的metricCollector注册表加入
+type hystrixCircuitStates struct {
+	circuits sync.Map //name -> *hystrixCircuitState
+}
+
+func newHystrixCircuitStates() *hystrixCircuitStates {
+	s := &hystrixCircuitStates{}
+	metricCollector.Registry.Register(func(name string) metricCollector.MetricCollector {
+		state := &hystrixCircuitState{}
+		actual, _ := s.circuits.LoadOrStore(name, state)
+		return actual.(*hystrixCircuitState)
+	})
+	return s
+}
+
+// hystrixCircuitState 实现metricCollector.MetricCollector，按执行结果记录熔断器是否打开
+// 被熔断的执行记为打开，成功的执行记为关闭，不调用熔断器的方法以免抓取时改变其状态
+type hystrixCircuitState struct {
+	open atomic.Bool
+}
+
+// Update 实现metricCollector.MetricCollector
+func (s *hystrixCircuitState) Update(r metricCollector.MetricResult) {
+	if r.ShortCircuits > 0 {
+		s.open.Store(true)
+	} else if r.Successes > 0 {
+		s.open.Store(false)
+	}
+}
+
+// Reset 实现metricCollector.MetricCollector
+func (s *hystrixCircuitState) Reset() {
+	s.open.Store(false)
+}
+
+// hystrixCollector 在抓取时读取已创建的hystrix熔断器状态
+type hystrixCollector struct {
+	open *prometheus.Desc
+}
+
+func newHystrixCollector() *hystrixCollector {
+	return &hystrixCollector{
+		open: prometheus.NewDesc("letsgo_hystrix_circuit_open", "Whether the hystrix circuit was open (1) or closed (0) at its last execution.", []string{"name"}, nil),
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *hystrixCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+}
+
+// Collect 实现prometheus.Collector，只报告已创建的熔断器
+func (c *hystrixCollector) Collect(ch chan<- prometheus.Metric) {
+	states := make(map[string]*hystrixCircuitState)
+	names := make([]string, 0)
+	hystrixCircuits.circuits.Range(func(key, value interface{}) bool {
+		states[key.(string)] = value.(*hystrixCircuitState)
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	for _, name := range names {
+		var open float64
+		if states[name].open.Load() {
+			open = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, open, name)
+	}
+}
@@ -4,23 +4,15 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
-	"time"
 )
 
 //Mu panic使用的全局锁
 var Mu sync.Mutex
 
-//PanicFunc panic及recover函数
+//PanicFunc panic及recover函数，使用Default的结构化日志记录panic及堆栈
 func PanicFunc() {
 	if err := recover(); err != nil {
-		Mu.Lock()
-		now := time.Now()
-		timet := now.Format("@2006-01-02 15:04:05")
-		fmt.Printf("===Letsgo Panic Recover %s===\n%s\n", timet, err)
-		PrintStack()
-		fmt.Printf("===Letsgo Panic Recover End===\n\n")
-		Mu.Unlock()
-
+		logPanic(defaultLogger(), err)
 	}
 }
 
@@ -2,7 +2,7 @@ package letsgo
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/gomodule/redigo/redis" //redigo
@@ -12,6 +12,7 @@ import (
 //Lredisc 结构体
 type Lredisc struct {
 	Redisc *redisc.Cluster
+	Logger *slog.Logger
 }
 
 //newLredisc 返回一个Lredis结构体指针
@@ -39,7 +40,8 @@ func (c *Lredisc) GetConn(Retry bool) redis.Conn {
 	if Retry == true {
 		retryConn, err := redisc.RetryConn(rediscconn, 3, 100*time.Millisecond)
 		if err != nil {
-			log.Fatal("RetryConn failed:", err)
+			loggerOr(c.Logger).Error("Redisc RetryConn failed, use conn without retry", slog.Any("error", err))
+			return rediscconn
 		}
 		return retryConn
 	} else {
@@ -0,0 +1,395 @@
+package letsgo
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis" //redigo
+)
+
+// sentinelRefreshInterval 定时向sentinel确认主从节点的间隔，防止漏掉事件
+const sentinelRefreshInterval = 30 * time.Second
+
+// sentinelEvents 需要重新解析主从节点的sentinel事件
+var sentinelEvents = []string{"+switch-master", "+slave", "+sdown", "-sdown"}
+
+// SentinelOptions sentinel模式的配置
+type SentinelOptions struct {
+	DialOptions      []redis.DialOption //连接sentinel的选项，为空时连接与读写超时为1秒，sentinel开启认证时需加上redis.DialPassword
+	ReadFromReplicas bool               //只读命令发往从节点，从节点的复制有延迟，写后立即读可能读到旧值
+}
+
+// Lredissentinel 由sentinel管理的主从redis，主节点切换后自动连接新的主节点
+type Lredissentinel struct {
+	MasterName  string
+	Sentinels   []string
+	Options     SentinelOptions
+	Logger      *slog.Logger
+	dialOptions []redis.DialOption
+	master      *redis.Pool
+	masterAddr  string
+	replicas    map[string]*redis.Pool
+	replicaList []*redis.Pool
+	next        atomic.Uint32
+	lock        sync.RWMutex
+	refreshLock sync.Mutex
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// newLredissentinel 返回一个Lredissentinel结构体指针
+func newLredissentinel(opts SentinelOptions) *Lredissentinel {
+	return &Lredissentinel{Options: opts, replicas: make(map[string]*redis.Pool)}
+}
+
+// Init 连接sentinel管理的redis，serverlist[0]为主节点名称，其余为sentinel地址
+func (c *Lredissentinel) Init(serverlist []string, options []redis.DialOption) error {
+	if len(serverlist) < 2 {
+		return fmt.Errorf("Lredissentinel: needs master name and at least one sentinel")
+	}
+	c.MasterName = serverlist[0]
+	c.Sentinels = append([]string{}, serverlist[1:]...)
+	c.dialOptions = options
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.watch()
+	return nil
+}
+
+// GetConn 得到一个redis.Conn，开启ReadFromReplicas时只读命令发往从节点
+func (c *Lredissentinel) GetConn(Retry bool) redis.Conn {
+	c.lock.RLock()
+	master := c.master
+	c.lock.RUnlock()
+	if !c.Options.ReadFromReplicas {
+		return master.Get()
+	}
+	return &sentinelConn{s: c, master: master.Get()}
+}
+
+// DoOnce 在主节点上执行命令
+func (c *Lredissentinel) DoOnce(commandName string, args ...interface{}) (reply interface{}, err error) {
+	c.lock.RLock()
+	redisconn := c.master.Get()
+	c.lock.RUnlock()
+	defer redisconn.Close()
+	if redisconn.Err() != nil {
+		return nil, fmt.Errorf("Lredissentinel:err while conn: %s", redisconn.Err().Error())
+	}
+	return redisconn.Do(commandName, args...)
+}
+
+// Close 停止监听sentinel并关闭全部连接池
+func (c *Lredissentinel) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, pool := range c.replicas {
+		pool.Close()
+	}
+	c.replicas = make(map[string]*redis.Pool)
+	c.replicaList = nil
+	if c.master != nil {
+		return c.master.Close()
+	}
+	return nil
+}
+
+// MasterAddr 返回当前主节点地址
+func (c *Lredissentinel) MasterAddr() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.masterAddr
+}
+
+// replica 轮询返回一个从节点连接池，没有可用从节点时返回nil
+func (c *Lredissentinel) replica() *redis.Pool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.replicaList) == 0 {
+		return nil
+	}
+	return c.replicaList[int(c.next.Add(1))%len(c.replicaList)]
+}
+
+// refresh 向sentinel查询主从节点，地址变化时替换连接池
+func (c *Lredissentinel) refresh() error {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+
+	var masterAddr string
+	var replicaAddrs []string
+	err := c.querySentinels(func(conn redis.Conn) error {
+		addr, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", c.MasterName))
+		if err == redis.ErrNil || (err == nil && len(addr) != 2) {
+			return fmt.Errorf("master %s not found", c.MasterName)
+		}
+		if err != nil {
+			return err
+		}
+		masterAddr = net.JoinHostPort(addr[0], addr[1])
+		if c.Options.ReadFromReplicas {
+			replicaAddrs, err = sentinelReplicas(conn, c.MasterName)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Lredissentinel: %s", err.Error())
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if masterAddr != c.masterAddr {
+		pool, _ := RedisCreatePool(masterAddr, c.dialOptions...)
+		//切换后旧主节点变为从节点，借出时确认角色，丢弃指向旧主节点的连接
+		pool.TestOnBorrow = func(conn redis.Conn, t time.Time) error {
+			role, err := redis.Values(conn.Do("ROLE"))
+			if err != nil {
+				return err
+			}
+			if len(role) == 0 || fmt.Sprintf("%s", role[0]) != "master" {
+				return fmt.Errorf("Lredissentinel: %s is not master", masterAddr)
+			}
+			return nil
+		}
+		if c.master != nil {
+			loggerOr(c.Logger).Warn("Lredissentinel switch master", slog.String("master", c.MasterName), slog.String("from", c.masterAddr), slog.String("to", masterAddr))
+			c.master.Close()
+		}
+		c.master = pool
+		c.masterAddr = masterAddr
+	}
+
+	replicas := make(map[string]*redis.Pool, len(replicaAddrs))
+	list := make([]*redis.Pool, 0, len(replicaAddrs))
+	for _, addr := range replicaAddrs {
+		pool, ok := c.replicas[addr]
+		if !ok {
+			pool, _ = RedisCreatePool(addr, c.dialOptions...)
+		}
+		replicas[addr] = pool
+		list = append(list, pool)
+	}
+	for addr, pool := range c.replicas {
+		if _, ok := replicas[addr]; !ok {
+			pool.Close()
+		}
+	}
+	c.replicas = replicas
+	c.replicaList = list
+	return nil
+}
+
+// sentinelReplicas 返回主节点名称下状态正常的从节点地址
+func sentinelReplicas(conn redis.Conn, name string) ([]string, error) {
+	reply, err := redis.Values(conn.Do("SENTINEL", "replicas", name))
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown") {
+		//redis 5.0之前的sentinel只支持slaves
+		reply, err = redis.Values(conn.Do("SENTINEL", "slaves", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, item := range reply {
+		fields, err := redis.StringMap(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		flags := fields["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+		if status, ok := fields["master-link-status"]; ok && status != "ok" {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(fields["ip"], fields["port"]))
+	}
+	return addrs, nil
+}
+
+// querySentinels 依次连接sentinel执行fn，成功的sentinel移到列表最前
+func (c *Lredissentinel) querySentinels(fn func(conn redis.Conn) error) error {
+	var lasterr error
+	for k, addr := range c.Sentinels {
+		conn, err := redis.Dial("tcp", addr, c.sentinelDialOptions()...)
+		if err != nil {
+			lasterr = err
+			continue
+		}
+		err = fn(conn)
+		conn.Close()
+		if err != nil {
+			lasterr = err
+			continue
+		}
+		if k > 0 {
+			c.Sentinels[0], c.Sentinels[k] = c.Sentinels[k], c.Sentinels[0]
+		}
+		return nil
+	}
+	return lasterr
+}
+
+// sentinel 返回第k个sentinel地址，超出时循环
+func (c *Lredissentinel) sentinel(k int) string {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+	return c.Sentinels[k%len(c.Sentinels)]
+}
+
+// sentinelDialOptions 连接sentinel使用的选项
+func (c *Lredissentinel) sentinelDialOptions() []redis.DialOption {
+	if len(c.Options.DialOptions) > 0 {
+		return c.Options.DialOptions
+	}
+	return []redis.DialOption{redis.DialConnectTimeout(time.Second), redis.DialReadTimeout(time.Second), redis.DialWriteTimeout(time.Second)}
+}
+
+// watch 订阅sentinel事件，主从变化时重新解析，断线后换一个sentinel重连，并定时确认以防漏掉事件
+func (c *Lredissentinel) watch() {
+	defer close(c.done)
+	loop := pubSubLoop{
+		stop:     c.stop,
+		interval: sentinelRefreshInterval,
+		connect: func(attempt int) (*redis.PubSubConn, error) {
+			return c.subscribeEvents(c.sentinel(attempt))
+		},
+		handle: func(n redis.Message) {
+			//事件内容中包含主节点名称，如+switch-master <name> <oldip> <oldport> <newip> <newport>
+			if !containsField(string(n.Data), c.MasterName) {
+				return
+			}
+			if err := c.refresh(); err != nil {
+				loggerOr(c.Logger).Warn("Lredissentinel refresh", slog.String("master", c.MasterName), slog.String("event", n.Channel), slog.Any("error", err))
+			}
+		},
+		tick: func() {
+			if err := c.refresh(); err != nil {
+				loggerOr(c.Logger).Warn("Lredissentinel refresh", slog.String("master", c.MasterName), slog.Any("error", err))
+			}
+		},
+		lost: func(err error, retry time.Duration) {
+			loggerOr(c.Logger).Warn("Lredissentinel sentinel subscription lost, reconnecting", slog.String("master", c.MasterName), slog.Duration("retry_after", retry), slog.Any("error", err))
+		},
+	}
+	loop.run(nil)
+}
+
+// subscribeEvents 连接一个sentinel并订阅事件
+func (c *Lredissentinel) subscribeEvents(addr string) (*redis.PubSubConn, error) {
+	conn, err := redis.Dial("tcp", addr, c.sentinelDialOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	psc := &redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(redis.Args{}.AddFlat(sentinelEvents)...); err != nil {
+		psc.Close()
+		return nil, err
+	}
+	//订阅前可能已发生切换，重新确认一次
+	if err := c.refresh(); err != nil {
+		loggerOr(c.Logger).Warn("Lredissentinel refresh", slog.String("master", c.MasterName), slog.Any("error", err))
+	}
+	return psc, nil
+}
+
+// containsField s按空格拆分后是否包含field
+func containsField(s string, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyCommands 开启ReadFromReplicas时发往从节点的命令
+var readOnlyCommands = map[string]bool{
+	"GET": true, "MGET": true, "EXISTS": true, "TTL": true, "PTTL": true, "STRLEN": true, "TYPE": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HEXISTS": true, "HLEN": true,
+	"LLEN": true, "LRANGE": true, "LINDEX": true,
+	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true,
+	"ZCARD": true, "ZSCORE": true, "ZRANGE": true, "ZRANGEBYSCORE": true, "ZCOUNT": true,
+	"XLEN": true, "XRANGE": true,
+}
+
+// sentinelConn 开启ReadFromReplicas时GetConn返回的连接，只读命令发往从节点，其余命令及Send、Receive使用主节点
+// 执行过非只读命令或Send（如MULTI、WATCH）后，之后的全部命令都发往主节点，保证事务与写后读的一致性
+type sentinelConn struct {
+	s       *Lredissentinel
+	master  redis.Conn
+	replica redis.Conn
+	pinned  bool
+}
+
+func (c *sentinelConn) Close() error {
+	if c.replica != nil {
+		c.replica.Close()
+	}
+	return c.master.Close()
+}
+
+func (c *sentinelConn) Err() error {
+	return c.master.Err()
+}
+
+func (c *sentinelConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if !c.pinned && readOnlyCommands[strings.ToUpper(commandName)] {
+		if replica := c.replicaConn(); replica != nil {
+			reply, err := replica.Do(commandName, args...)
+			if replica.Err() == nil {
+				return reply, err
+			}
+			//从节点连接异常时改用主节点
+		}
+	}
+	c.pinned = true
+	return c.master.Do(commandName, args...)
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	c.pinned = true
+	return redis.DoWithTimeout(c.master, timeout, commandName, args...)
+}
+
+func (c *sentinelConn) Send(commandName string, args ...interface{}) error {
+	c.pinned = true
+	return c.master.Send(commandName, args...)
+}
+
+func (c *sentinelConn) Flush() error {
+	return c.master.Flush()
+}
+
+func (c *sentinelConn) Receive() (interface{}, error) {
+	return c.master.Receive()
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.master, timeout)
+}
+
+// replicaConn 第一次使用时从从节点连接池取得连接
+func (c *sentinelConn) replicaConn() redis.Conn {
+	if c.replica == nil {
+		pool := c.s.replica()
+		if pool == nil {
+			return nil
+		}
+		c.replica = pool.Get()
+	}
+	return c.replica
+}
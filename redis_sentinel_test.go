@@ -0,0 +1,27 @@
+package letsgo
+
+import "testing"
+
+func TestContainsField(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		field string
+		want  bool
+	}{
+		{"switch-master", "mymaster 10.0.0.1 6379 10.0.0.2 6379", "mymaster", true},
+		{"sdown of replica", "slave 10.0.0.3:6379 10.0.0.3 6379 @ mymaster 10.0.0.1 6379", "mymaster", true},
+		{"other master", "othermaster 10.0.0.1 6379 10.0.0.2 6379", "mymaster", false},
+		{"name is prefix of other master", "mymaster2 10.0.0.1 6379 10.0.0.2 6379", "mymaster", false},
+		{"name is suffix of other master", "old-mymaster 10.0.0.1 6379", "mymaster", false},
+		{"extra whitespace", "  mymaster\t10.0.0.1  ", "mymaster", true},
+		{"empty event", "", "mymaster", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsField(tt.s, tt.field); got != tt.want {
+				t.Fatalf("containsField(%q, %q) = %v, want %v", tt.s, tt.field, got, tt.want)
+			}
+		})
+	}
+}
@@ -43,5 +43,8 @@ func (c *Lredis) DoOnce(commandName string, args ...interface{}) (reply interfac
 }
 
 func (c *Lredis) Close() error {
+	if c.Redis == nil {
+		return nil
+	}
 	return c.Redis.Close()
 }
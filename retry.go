@@ -0,0 +1,96 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// 启动依赖名称，用于Letsgo.SetStartupRetry
+const (
+	DependencyLog       = "log"
+	DependencyDB        = "db"
+	DependencyRedis     = "redis"
+	DependencyHTTPQuery = "http_query"
+	DependencyCacheLock = "cache_lock"
+)
+
+// RetryPolicy 启动时连接依赖的重试退避策略
+type RetryPolicy struct {
+	MaxAttempts    int           //最多尝试次数，小于等于1表示不重试
+	InitialBackoff time.Duration //第一次重试前等待时长
+	MaxBackoff     time.Duration //退避等待上限，0表示不设上限
+	Multiplier     float64       //每次退避时长倍数，小于1按1处理
+}
+
+// backoff 第attempt次失败后的等待时长，attempt从1开始
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		wait = time.Duration(float64(wait) * multiplier)
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// InitError 初始化依赖失败时返回的错误
+type InitError struct {
+	Dependency string
+	Attempts   int
+	Err        error
+}
+
+func (e *InitError) Error() string {
+	return fmt.Sprintf("[error]%s init failed after %d attempt(s): %s", e.Dependency, e.Attempts, e.Err.Error())
+}
+
+// Unwrap 返回原始错误
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
+
+// SetStartupRetry 设置某个依赖在启动时的重试策略
+func (L *Letsgo) SetStartupRetry(dependency string, policy RetryPolicy) {
+	if L.StartupRetry == nil {
+		L.StartupRetry = make(map[string]RetryPolicy)
+	}
+	L.StartupRetry[dependency] = policy
+}
+
+// withStartupRetry 按依赖的重试策略执行fn，全部失败或StartupContext取消时返回*InitError
+func (L *Letsgo) withStartupRetry(dependency string, fn func() error) error {
+	ctx := L.StartupContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	policy := L.StartupRetry[dependency]
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		wait := policy.backoff(attempt)
+		L.logger().Warn("init attempt failed", slog.String("dependency", dependency), slog.Int("attempt", attempt), slog.Duration("retry_after", wait), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return &InitError{Dependency: dependency, Attempts: attempt, Err: fmt.Errorf("%w (startup canceled: %v)", err, ctx.Err())}
+		case <-time.After(wait):
+		}
+	}
+	return &InitError{Dependency: dependency, Attempts: attempts, Err: err}
+}
@@ -0,0 +1,104 @@
+package letsgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestWithStartupRetrySucceedsAfterFailures(t *testing.T) {
+	L := New()
+	L.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	L.SetStartupRetry(DependencyRedis, RetryPolicy{MaxAttempts: 3})
+
+	calls := 0
+	err := L.withStartupRetry(DependencyRedis, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withStartupRetry returned %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3", calls)
+	}
+}
+
+func TestWithStartupRetryReturnsInitError(t *testing.T) {
+	L := New()
+	L.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	L.SetStartupRetry(DependencyDB, RetryPolicy{MaxAttempts: 2})
+
+	cause := errors.New("connection refused")
+	calls := 0
+	err := L.withStartupRetry(DependencyDB, func() error {
+		calls++
+		return cause
+	})
+	var initerr *InitError
+	if !errors.As(err, &initerr) {
+		t.Fatalf("withStartupRetry returned %T, want *InitError", err)
+	}
+	if initerr.Dependency != DependencyDB || initerr.Attempts != 2 || calls != 2 {
+		t.Fatalf("got dependency=%s attempts=%d calls=%d, want db 2 2", initerr.Dependency, initerr.Attempts, calls)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatalf("InitError does not unwrap to the original error")
+	}
+}
+
+func TestWithStartupRetryWithoutPolicyTriesOnce(t *testing.T) {
+	L := New()
+	calls := 0
+	err := L.withStartupRetry(DependencyLog, func() error {
+		calls++
+		return errors.New("fail")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("got err=%v calls=%d, want error after 1 call", err, calls)
+	}
+}
+
+func TestWithStartupRetryStopsOnContextCancel(t *testing.T) {
+	L := New()
+	L.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	L.SetStartupRetry(DependencyRedis, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	L.StartupContext = ctx
+
+	calls := 0
+	start := time.Now()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err := L.withStartupRetry(DependencyRedis, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	var initerr *InitError
+	if !errors.As(err, &initerr) || initerr.Attempts != 1 || calls != 1 {
+		t.Fatalf("got err=%v calls=%d, want InitError after 1 attempt", err, calls)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("withStartupRetry was not interrupted by ctx")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for k, w := range want {
+		if got := p.backoff(k + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", k+1, got, w)
+		}
+	}
+
+	p = RetryPolicy{InitialBackoff: 50 * time.Millisecond, Multiplier: 0.5}
+	if got := p.backoff(3); got != 50*time.Millisecond {
+		t.Errorf("backoff with multiplier < 1 = %s, want 50ms", got)
+	}
+}
@@ -0,0 +1,319 @@
+package letsgo
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 备份文件名中的时间格式
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions 日志文件切割与保留配置，全部为零值时不切割
+type RotateOptions struct {
+	MaxSizeMB  int           //单个文件最大MB，超过后切割，0不按大小切割
+	Interval   time.Duration //按时间切割的周期，如24h，按UTC对齐，0不按时间切割
+	MaxBackups int           //最多保留的备份数，0不限制
+	MaxAge     time.Duration //备份最长保留时间，0不限制
+	Compress   bool          //是否gzip压缩备份
+	Perm       os.FileMode   //文件权限，默认0640
+}
+
+// RotateWriter 支持按大小/时间切割、压缩、保留策略及重新打开的日志文件writer，可并发使用
+type RotateWriter struct {
+	Filename string
+	Options  RotateOptions
+	file     *os.File
+	size     int64
+	next     time.Time //下一次按时间切割的时刻
+	closed   bool
+	lock     sync.Mutex
+	mill     sync.Mutex //串行化压缩与清理
+	millWG   sync.WaitGroup
+}
+
+// NewRotateWriter 打开filename并返回RotateWriter
+func NewRotateWriter(filename string, opts RotateOptions) (*RotateWriter, error) {
+	if opts.Perm == 0 {
+		opts.Perm = 0640
+	}
+	w := &RotateWriter{Filename: filename, Options: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 实现io.Writer，写入前按需切割
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate 立即切割当前文件
+func (w *RotateWriter) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen 关闭并重新打开文件，供外部logrotate移动文件后调用
+func (w *RotateWriter) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Close 关闭文件并等待正在进行的压缩与清理
+func (w *RotateWriter) Close() error {
+	w.lock.Lock()
+	var err error
+	w.closed = true
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.lock.Unlock()
+	w.millWG.Wait()
+	return err
+}
+
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Filename), 0755); err != nil {
+		return fmt.Errorf("[error]RotateWriter mkdir: %w", err)
+	}
+	file, err := os.OpenFile(w.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, w.Options.Perm)
+	if err != nil {
+		return fmt.Errorf("[error]RotateWriter open %s: %w", w.Filename, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("[error]RotateWriter stat %s: %w", w.Filename, err)
+	}
+	w.file = file
+	w.size = info.Size()
+	if w.Options.Interval > 0 {
+		w.next = time.Now().UTC().Truncate(w.Options.Interval).Add(w.Options.Interval)
+	}
+	return nil
+}
+
+func (w *RotateWriter) shouldRotate(n int64) bool {
+	if w.Options.MaxSizeMB > 0 && w.size > 0 && w.size+n > int64(w.Options.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return w.Options.Interval > 0 && !time.Now().Before(w.next)
+}
+
+// rotate 将当前文件重命名为带时间戳的备份并打开新文件，调用方需持有lock
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("[error]RotateWriter close: %w", err)
+		}
+		w.file = nil
+	}
+	if _, err := os.Stat(w.Filename); err == nil {
+		if err := os.Rename(w.Filename, w.backupName(time.Now())); err != nil {
+			return fmt.Errorf("[error]RotateWriter rename: %w", err)
+		}
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.millWG.Add(1)
+	go func() {
+		defer w.millWG.Done()
+		w.millRun()
+	}()
+	return nil
+}
+
+// backupName 返回name-时间.ext形式的备份文件名
+func (w *RotateWriter) backupName(t time.Time) string {
+	dir, base := filepath.Split(w.Filename)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, prefix+"-"+t.UTC().Format(rotateTimeFormat)+ext)
+}
+
+// rotateBackup 备份文件信息
+type rotateBackup struct {
+	path string
+	t    time.Time
+}
+
+// backups 返回全部备份，按时间从新到旧排序
+func (w *RotateWriter) backups() ([]rotateBackup, error) {
+	dir, base := filepath.Split(w.Filename)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []rotateBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp = strings.TrimSuffix(stamp, ext)
+		t, err := time.Parse(rotateTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, rotateBackup{path: filepath.Join(dir, name), t: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+	return backups, nil
+}
+
+// millRun 压缩未压缩的备份并按保留策略删除旧备份
+func (w *RotateWriter) millRun() {
+	w.mill.Lock()
+	defer w.mill.Unlock()
+
+	backups, err := w.backups()
+	if err != nil {
+		return
+	}
+
+	var cutoff time.Time
+	if w.Options.MaxAge > 0 {
+		cutoff = time.Now().Add(-w.Options.MaxAge)
+	}
+	for k, backup := range backups {
+		if (w.Options.MaxBackups > 0 && k >= w.Options.MaxBackups) || (!cutoff.IsZero() && backup.t.Before(cutoff)) {
+			os.Remove(backup.path)
+			continue
+		}
+		if w.Options.Compress && !strings.HasSuffix(backup.path, ".gz") {
+			if err := gzipFile(backup.path, w.Options.Perm); err != nil {
+				//日志文件自身异常时写入标准日志，避免写回正在切割的文件
+				slog.Default().Error("RotateWriter compress", slog.String("file", backup.path), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// gzipFile 将path压缩为path.gz并删除原文件
+func gzipFile(path string, perm os.FileMode) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(path + ".gz")
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// reopenOnSIGHUP 登记在收到SIGHUP时需要重新打开的writer，首次调用时启动信号监听
+func (L *Letsgo) reopenOnSIGHUP(w *RotateWriter) {
+	L.hupLock.Lock()
+	defer L.hupLock.Unlock()
+	L.hupWriters = append(L.hupWriters, w)
+	if L.hupStop != nil {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	L.hupStop = stop
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				L.hupLock.Lock()
+				writers := append([]*RotateWriter{}, L.hupWriters...)
+				L.hupLock.Unlock()
+				for _, writer := range writers {
+					if err := writer.Reopen(); err != nil {
+						slog.Default().Error("SIGHUP reopen", slog.String("file", writer.Filename), slog.Any("error", err))
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSIGHUP 停止SIGHUP监听
+func (L *Letsgo) stopSIGHUP() {
+	L.hupLock.Lock()
+	defer L.hupLock.Unlock()
+	if L.hupStop != nil {
+		close(L.hupStop)
+		L.hupStop = nil
+	}
+	L.hupWriters = nil
+}
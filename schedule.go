@@ -5,10 +5,16 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/time2k/letsgo-ng/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Scheduler 调度器接口
@@ -20,6 +26,11 @@ type Scheduler interface {
 
 // Schedule 结构体
 type Schedule struct {
+	Workercounter     int
+	WorkercounterLock sync.Mutex
+	Metrics           *Metrics
+	Tracer            trace.Tracer
+	Logger            *slog.Logger
 }
 
 // newSchedule 返回一个Schedule类型指针
@@ -32,6 +43,27 @@ func (c *Schedule) Init() {
 
 }
 
+// AddCounter 内置计数器++
+func (c *Schedule) AddCounter() {
+	c.WorkercounterLock.Lock()
+	defer c.WorkercounterLock.Unlock()
+	c.Workercounter++
+}
+
+// SubCounter 内置计数器--
+func (c *Schedule) SubCounter() {
+	c.WorkercounterLock.Lock()
+	defer c.WorkercounterLock.Unlock()
+	c.Workercounter--
+}
+
+// GetCounter 读取内置计数器，即在途工人数量
+func (c *Schedule) GetCounter() int {
+	c.WorkercounterLock.Lock()
+	defer c.WorkercounterLock.Unlock()
+	return c.Workercounter
+}
+
 // Run 运行多协程model函数调度器
 func (c *Schedule) Run(ser Scheduler) ([]BaseReturnData, error) {
 	sch := ser.GetBuilder()
@@ -49,6 +81,7 @@ func (c *Schedule) Run(ser Scheduler) ([]BaseReturnData, error) {
 		debug.Add(fmt.Sprintln("Schedule seqid", seqid))
 
 		//worker run
+		c.AddCounter()
 		go c.ScheduleWorker(sch, debug, k, seqid)
 		NeedSchSum++
 	}
@@ -78,15 +111,39 @@ func (c *Schedule) Run(ser Scheduler) ([]BaseReturnData, error) {
 
 // ScheduleWorker 调度器工人
 func (c *Schedule) ScheduleWorker(sch *ScheduleBuilder, debug *DebugInfo, index int, seqid string) {
-	defer PanicFunc()
+	defer c.SubCounter()
+	defer c.recoverWorker()
+	desc := sch.FuncDescs[index]
+	funcname := runtime.FuncForPC(reflect.ValueOf(desc.ModelFunc).Pointer()).Name()
+
+	//在worker span下运行model函数，函数内的DB、缓存、HTTP调用成为其子span
+	commp := desc.CommP
+	ctx, span := startSpan(c.Tracer, commp.GetContext(), "schedule.worker", trace.WithAttributes(attribute.String("code.function", funcname)))
+	defer span.End()
+	if commp != nil && span.SpanContext().IsValid() {
+		spancommp := *commp
+		spancommp.Ctx = ctx
+		commp = &spancommp
+	}
+
 	start := time.Now()
 	//运行函数
-	ret := sch.FuncDescs[index].ModelFunc(sch.FuncDescs[index].CommP, sch.FuncDescs[index].Args...)
+	ret := desc.ModelFunc(commp, desc.Args...)
 	end := time.Since(start)
-	debug.Add(fmt.Sprintln("Worker Time Cost", end, "seqid", seqid, "args", sch.FuncDescs[index].Args))
+	if c.Metrics != nil {
+		c.Metrics.ObserveSchedule(funcname, end)
+	}
+	debug.Add(fmt.Sprintln("Worker Time Cost", end, "seqid", seqid, "args", desc.Args))
 	sch.DataCH <- ScheduleChan{SEQID: seqid, RET: ret}
 }
 
+// recoverWorker 记录工人中的panic，避免单个model函数拖垮进程
+func (c *Schedule) recoverWorker() {
+	if err := recover(); err != nil {
+		logPanic(loggerOr(c.Logger), err)
+	}
+}
+
 // GenUniqID 生成唯一id
 func (c *Schedule) GenUniqID() string {
 	un := time.Now().UnixNano()
@@ -0,0 +1,255 @@
+package letsgo
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ServerOptions Serve使用的服务端配置
+type ServerOptions struct {
+	ServiceName string        //微服务注册名称，不为空且MicroserviceClient可用时在监听后自动注册
+	BodyLimit   string        //请求体大小限制，如4M，为空不限制
+	Timeout     time.Duration //单个请求处理超时，0不限制
+	AccessLog   bool          //是否记录访问日志
+	TLSCertFile string        //证书文件，与TLSKeyFile同时设置时启用https
+	TLSKeyFile  string
+	TLSConfig   *tls.Config //自定义tls配置，优先于证书文件
+}
+
+// RouteOption 注册路由时的可选参数
+type RouteOption func(*routeOptions)
+
+// routeOptions 单个路由的参数集合
+type routeOptions struct {
+	middleware []echo.MiddlewareFunc
+	name       string
+}
+
+// WithMiddleware 为单个路由增加中间件
+func WithMiddleware(m ...echo.MiddlewareFunc) RouteOption {
+	return func(o *routeOptions) {
+		o.middleware = append(o.middleware, m...)
+	}
+}
+
+// WithRouteName 设置路由名称，可用于echo.Reverse
+func WithRouteName(name string) RouteOption {
+	return func(o *routeOptions) {
+		o.name = name
+	}
+}
+
+// echo 返回本实例的echo，首次调用时创建并安装标准中间件
+func (L *Letsgo) echo() *echo.Echo {
+	L.echoLock.Lock()
+	defer L.echoLock.Unlock()
+	if L.Echo == nil {
+		e := echo.New()
+		e.HideBanner = true
+		e.HidePort = true
+		e.Use(L.recoverMiddleware(), middleware.RequestID(), L.TraceMiddleware())
+		L.Echo = e
+	}
+	return L.Echo
+}
+
+// Add 注册路由，handler通过L.Handler包装
+func (L *Letsgo) Add(method string, path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	o := routeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	route := L.echo().Add(method, path, L.Handler(h), o.middleware...)
+	if o.name != "" {
+		route.Name = o.name
+	}
+	return route
+}
+
+// GET 注册GET路由
+func (L *Letsgo) GET(path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	return L.Add(http.MethodGet, path, h, opts...)
+}
+
+// POST 注册POST路由
+func (L *Letsgo) POST(path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	return L.Add(http.MethodPost, path, h, opts...)
+}
+
+// PUT 注册PUT路由
+func (L *Letsgo) PUT(path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	return L.Add(http.MethodPut, path, h, opts...)
+}
+
+// DELETE 注册DELETE路由
+func (L *Letsgo) DELETE(path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	return L.Add(http.MethodDelete, path, h, opts...)
+}
+
+// PATCH 注册PATCH路由
+func (L *Letsgo) PATCH(path string, h HandlerFunc, opts ...RouteOption) *echo.Route {
+	return L.Add(http.MethodPatch, path, h, opts...)
+}
+
+// Routes 返回已注册的全部路由
+func (L *Letsgo) Routes() []*echo.Route {
+	return L.echo().Routes()
+}
+
+// Serve 按ServerOptions安装中间件并在addr上监听，阻塞直到服务关闭
+// 已初始化Health、Metrics时自动注册/healthz、/readyz、/metrics，已初始化Shutdown时由其负责优雅关闭
+func (L *Letsgo) Serve(addr string) error {
+	e := L.echo()
+	opts := L.ServerOptions
+
+	//中间件与内置路由只安装一次，重复调用Serve不会在echo上叠加中间件
+	L.serveOnce.Do(func() {
+		if opts.BodyLimit != "" {
+			e.Use(middleware.BodyLimit(opts.BodyLimit))
+		}
+		if opts.Timeout > 0 {
+			e.Use(middleware.ContextTimeout(opts.Timeout))
+		}
+		if opts.AccessLog {
+			e.Use(L.accessLogMiddleware())
+		}
+		if L.Health != nil {
+			L.RegisterHealthRoutes(e)
+		}
+		if L.Metrics != nil {
+			L.RegisterMetricsRoute(e)
+		}
+	})
+	if L.Shutdown != nil {
+		L.Shutdown.Echo = e
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("[error]Serve listen %s: %w", addr, err)
+	}
+
+	server := e.Server
+	tlsconfig, err := opts.tlsConfig()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	if tlsconfig != nil {
+		e.TLSServer.TLSConfig = tlsconfig
+		e.TLSListener = tls.NewListener(ln, tlsconfig)
+		server = e.TLSServer
+	} else {
+		e.Listener = ln
+	}
+
+	if err := L.registerService(ln.Addr()); err != nil {
+		ln.Close()
+		return err
+	}
+	L.logger().Info("Serve started", slog.String("addr", ln.Addr().String()), slog.Bool("tls", tlsconfig != nil))
+
+	err = e.StartServer(server)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// tlsConfig 返回启用https时使用的tls配置，未配置证书时返回nil
+func (o ServerOptions) tlsConfig() (*tls.Config, error) {
+	if o.TLSConfig != nil {
+		return o.TLSConfig, nil
+	}
+	if o.TLSCertFile == "" || o.TLSKeyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Serve load tls certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+}
+
+// registerService 监听成功后向注册中心注册服务
+func (L *Letsgo) registerService(addr net.Addr) error {
+	if L.ServerOptions.ServiceName == "" || L.MicroserviceClient == nil || !L.MicroserviceClient.IsActive() {
+		return nil
+	}
+	tcpaddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("[error]Serve register service: unsupported listener address %s", addr.String())
+	}
+	if err := L.MicroserviceClient.RegisterService(L.ServerOptions.ServiceName, tcpaddr.Port); err != nil {
+		return fmt.Errorf("[error]Serve register service %s: %w", L.ServerOptions.ServiceName, err)
+	}
+	L.logger().Info("Serve register service", slog.String("service", L.ServerOptions.ServiceName), slog.Int("port", tcpaddr.Port))
+	return nil
+}
+
+// recoverMiddleware 记录handler中的panic并返回500
+func (L *Letsgo) recoverMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer L.recoverHTTPError(&err)
+			return next(c)
+		}
+	}
+}
+
+// recoverHTTPError 记录panic并将err设置为500，需以defer L.recoverHTTPError(&err)方式调用
+func (L *Letsgo) recoverHTTPError(err *error) {
+	if r := recover(); r != nil {
+		logPanic(L.logger(), r)
+		*err = echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
+
+// accessLogMiddleware 使用结构化日志记录访问日志
+func (L *Letsgo) accessLogMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+			req := c.Request()
+			res := c.Response()
+			L.logger().Info("access",
+				slog.String("request_id", res.Header().Get(echo.HeaderXRequestID)),
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", res.Status),
+				slog.Int64("bytes", res.Size),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("ip", c.RealIP()),
+			)
+			return nil
+		}
+	}
+}
+
+// Handler letsgo框架加载handler，使用本实例的日志与链路追踪为每个请求创建span，handler中的panic返回500
+// 所在echo已安装TraceMiddleware时直接使用其结果，不重复创建span
+func (L *Letsgo) Handler(myfunc HandlerFunc) echo.HandlerFunc {
+	h := func(c echo.Context) (err error) {
+		defer L.recoverHTTPError(&err)
+		return myfunc(GenCommparams(c))
+	}
+	traced := L.TraceMiddleware()(h)
+	return func(c echo.Context) error {
+		if c != nil && c.Get(contextKeyRequestID) != nil {
+			return h(c)
+		}
+		return traced(c)
+	}
+}
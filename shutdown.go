@@ -0,0 +1,251 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 可关闭的资源名称，按初始化顺序记录在Letsgo中，关闭时逆序处理
+const (
+	resourceLog      = "log"
+	resourceCache    = "cache"
+	resourceDB       = "db"
+	resourceSSE      = "sse"
+	resourceTracing  = "tracing"
+	resourceHTTPDump = "http_dump"
+)
+
+// ShutdownHook 用户注册的关闭钩子
+type ShutdownHook struct {
+	Name string
+	Func func(ctx context.Context) error
+}
+
+// ShutdownCoordinator 优雅关闭协调器
+// 关闭顺序：从微服务注销 -> BeforeDrain钩子 -> 停止StreamWorker、DelayWorker -> 等待DB/HTTP/Schedule与缓存后台刷新的在途任务归零 -> 关闭echo -> 取消ContextSet -> BeforeClose钩子 -> 逆序关闭资源
+type ShutdownCoordinator struct {
+	L            *Letsgo
+	Echo         *echo.Echo
+	DrainTimeout time.Duration //整个关闭过程的最长时间
+	beforeDrain  []ShutdownHook
+	beforeClose  []ShutdownHook
+	lock         sync.Mutex
+	once         sync.Once
+	err          error
+}
+
+// newShutdownCoordinator 返回一个ShutdownCoordinator结构体指针
+func newShutdownCoordinator(L *Letsgo) *ShutdownCoordinator {
+	return &ShutdownCoordinator{L: L, DrainTimeout: 30 * time.Second}
+}
+
+// InitShutdown 初始化优雅关闭协调器，e可以为nil
+func (L *Letsgo) InitShutdown(e *echo.Echo, DrainTimeout time.Duration) {
+	L.Shutdown = newShutdownCoordinator(L)
+	L.Shutdown.Echo = e
+	if DrainTimeout > 0 {
+		L.Shutdown.DrainTimeout = DrainTimeout
+	}
+}
+
+// BeforeDrain 注册在等待在途任务之前执行的钩子，如停止消费队列
+func (s *ShutdownCoordinator) BeforeDrain(name string, fn func(ctx context.Context) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.beforeDrain = append(s.beforeDrain, ShutdownHook{Name: name, Func: fn})
+}
+
+// BeforeClose 注册在关闭框架资源之前执行的钩子，如关闭用户自己的连接
+func (s *ShutdownCoordinator) BeforeClose(name string, fn func(ctx context.Context) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.beforeClose = append(s.beforeClose, ShutdownHook{Name: name, Func: fn})
+}
+
+// Wait 阻塞直到收到SIGTERM或SIGINT，然后执行关闭流程
+func (s *ShutdownCoordinator) Wait() error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(ch)
+
+	sig := <-ch
+	s.L.logger().Info("Shutdown receive signal", slog.String("signal", sig.String()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.DrainTimeout)
+	defer cancel()
+	return s.Run(ctx)
+}
+
+// Run 执行关闭流程，多次调用只执行一次，ctx的deadline作为等待在途任务的最后期限
+func (s *ShutdownCoordinator) Run(ctx context.Context) error {
+	s.once.Do(func() {
+		s.err = s.run(ctx)
+	})
+	return s.err
+}
+
+func (s *ShutdownCoordinator) run(ctx context.Context) error {
+	L := s.L
+	var firsterr error
+	keep := func(err error) {
+		if err != nil && firsterr == nil {
+			firsterr = err
+		}
+	}
+
+	//先从注册中心注销，避免继续有流量进入
+	if L.MicroserviceClient != nil && L.MicroserviceClient.IsActive() {
+		if err := L.MicroserviceClient.DeregisterAllService(); err != nil {
+			s.L.logger().Error("Shutdown deregister service", slog.Any("error", err))
+			keep(err)
+		}
+	}
+
+	s.lock.Lock()
+	beforeDrain := append([]ShutdownHook{}, s.beforeDrain...)
+	beforeClose := append([]ShutdownHook{}, s.beforeClose...)
+	s.lock.Unlock()
+
+	keep(s.runHooks(ctx, beforeDrain))
+
+	if err := L.stopWorkers(ctx); err != nil {
+		s.L.logger().Error("Shutdown worker", slog.Any("error", err))
+		keep(err)
+	}
+
+	if err := s.drain(ctx); err != nil {
+		s.L.logger().Error("Shutdown drain", slog.Any("error", err))
+		keep(err)
+	}
+
+	if s.Echo != nil {
+		if err := s.Echo.Shutdown(ctx); err != nil {
+			s.L.logger().Error("Shutdown echo", slog.Any("error", err))
+			keep(err)
+		}
+	}
+
+	if L.ContextSet != nil {
+		L.ContextSet.CancelAll()
+	}
+
+	keep(s.runHooks(ctx, beforeClose))
+
+	L.closeResources()
+	return firsterr
+}
+
+// runHooks 依次执行钩子，返回第一个错误
+func (s *ShutdownCoordinator) runHooks(ctx context.Context, hooks []ShutdownHook) error {
+	var firsterr error
+	for _, hook := range hooks {
+		if err := hook.Func(ctx); err != nil {
+			s.L.logger().Error("Shutdown hook", slog.String("hook", hook.Name), slog.Any("error", err))
+			if firsterr == nil {
+				firsterr = fmt.Errorf("[error]Shutdown hook %s: %w", hook.Name, err)
+			}
+		}
+	}
+	return firsterr
+}
+
+// drain 等待DB、HTTP、Schedule与缓存后台刷新的在途任务归零或ctx到期
+func (s *ShutdownCoordinator) drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inflight := s.L.InFlight()
+		if inflight == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d task(s) still in flight: %w", inflight, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// InFlight 返回DB查询、HTTP请求、Schedule工人与缓存后台刷新的在途数量之和
+func (L *Letsgo) InFlight() int {
+	inflight := 0
+	for _, cache := range L.allCaches() {
+		inflight += int(cache.refreshCount.Load())
+	}
+	if L.DBQuery != nil {
+		inflight += L.DBQuery.GetCounter()
+	}
+	if L.HTTPQuery != nil {
+		inflight += L.HTTPQuery.GetCounter()
+	}
+	if L.Schedules != nil {
+		inflight += L.Schedules.GetCounter()
+	}
+	return inflight
+}
+
+// markInit 记录资源初始化顺序
+func (L *Letsgo) markInit(resource string) {
+	L.initLock.Lock()
+	defer L.initLock.Unlock()
+	for _, name := range L.initOrder {
+		if name == resource {
+			return
+		}
+	}
+	L.initOrder = append(L.initOrder, resource)
+}
+
+// closeResources 按初始化的逆序关闭资源
+func (L *Letsgo) closeResources() {
+	L.initLock.Lock()
+	order := make([]string, 0, len(L.initOrder))
+	for k := len(L.initOrder) - 1; k >= 0; k-- {
+		order = append(order, L.initOrder[k])
+	}
+	L.initOrder = nil
+	L.initLock.Unlock()
+
+	for _, resource := range order {
+		switch resource {
+		case resourceDB:
+			if L.DBC != nil {
+				closeDBC(L.DBC)
+			}
+		case resourceCache:
+			for _, cache := range L.allCaches() {
+				cache.Close()
+			}
+		case resourceSSE:
+			if L.SSE != nil && L.SSE.ServerInstant != nil {
+				L.SSE.ServerInstant.Close()
+			}
+		case resourceTracing:
+			if L.Tracing != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				L.Tracing.Provider.Shutdown(ctx)
+				cancel()
+			}
+		case resourceHTTPDump:
+			if L.HTTPQuery != nil {
+				L.HTTPQuery.CloseDumpLog()
+			}
+		case resourceLog:
+			if L.LogWriter != nil {
+				L.LogWriter.Close()
+			}
+			if L.LoggerFile != nil {
+				L.LoggerFile.Close()
+			}
+		}
+	}
+	L.stopSIGHUP()
+}
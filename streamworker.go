@@ -0,0 +1,299 @@
+package letsgo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// StreamHandler 处理一条消息，返回nil时确认消息，返回错误时消息留在pending列表中，由ClaimIdle到期后重新认领处理
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// StreamWorkerOptions 消费组工人配置
+type StreamWorkerOptions struct {
+	Stream        string
+	Group         string
+	Consumer      string        //消费者名称，为空时使用主机名加随机串；使用固定名称时重启后会先处理上次未确认的消息
+	Concurrency   int           //并发处理消息的协程数，默认1
+	Count         int           //每次读取的最大消息数，默认10
+	Block         time.Duration //没有消息时读取的最长阻塞时间，默认2秒，需小于redis连接的读超时
+	ClaimIdle     time.Duration //超过该时间未确认的消息会被认领重新处理，包括其他已崩溃消费者的消息，为0不认领
+	MaxDeliveries int64         //认领时投递次数超过该值的消息记录日志后直接确认丢弃，为0不限制
+	StartID       string        //创建消费组时的起始ID，默认$只消费之后的新消息，0为从头消费
+}
+
+// StreamWorker redis streams消费组工人，从stream读取消息并发交给Handler处理，处理成功后确认
+type StreamWorker struct {
+	Cache   *Cache
+	Options StreamWorkerOptions
+	Handler StreamHandler
+	Logger  *slog.Logger
+	workerLifecycle
+}
+
+// NewStreamWorker 返回一个StreamWorker结构体指针，需调用Start开始消费
+func (c *Cache) NewStreamWorker(opts StreamWorkerOptions, handler StreamHandler) *StreamWorker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Count <= 0 {
+		opts.Count = 10
+	}
+	if opts.Block <= 0 {
+		opts.Block = 2 * time.Second
+	}
+	if opts.Consumer == "" {
+		hostname, _ := os.Hostname()
+		opts.Consumer = hostname + "-" + genRequestID()[:8]
+	}
+	return &StreamWorker{Cache: c, Options: opts, Handler: handler, Logger: c.Logger}
+}
+
+// Start 创建消费组并开始消费，重复调用返回错误
+func (w *StreamWorker) Start() error {
+	if w.Options.Stream == "" || w.Options.Group == "" || w.Handler == nil {
+		return fmt.Errorf("[error]StreamWorker needs stream, group and handler")
+	}
+	if w.started() {
+		return fmt.Errorf("[error]StreamWorker %s/%s already started", w.Options.Stream, w.Options.Group)
+	}
+	if err := w.Cache.XGroupCreate(w.Options.Stream, w.Options.Group, w.Options.StartID); err != nil {
+		return err
+	}
+	if !w.start(w.run) {
+		return fmt.Errorf("[error]StreamWorker %s/%s already started", w.Options.Stream, w.Options.Group)
+	}
+	return nil
+}
+
+// Stop 停止读取新消息并等待处理中的消息完成，ctx到期时取消Handler的ctx并返回错误
+// 已读取但未处理的消息留在pending列表中，由其他消费者认领或本消费者重启后处理
+func (w *StreamWorker) Stop(ctx context.Context) error {
+	if err := w.shutdown(ctx); err != nil {
+		return fmt.Errorf("[error]StreamWorker %s/%s stop: %w", w.Options.Stream, w.Options.Group, err)
+	}
+	return nil
+}
+
+// run 读取消息并分发给处理协程，stop关闭后等待处理协程结束
+func (w *StreamWorker) run() {
+	logger := loggerOr(w.Logger)
+	jobs := make(chan StreamMessage)
+	var wg sync.WaitGroup
+	for k := 0; k < w.Options.Concurrency; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				w.handle(msg)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	id := "0" //先处理上次分配给本消费者但未确认的消息
+	lastClaim := time.Now()
+	backoff := 100 * time.Millisecond
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		var messages []StreamMessage
+		var err error
+		if w.Options.ClaimIdle > 0 && time.Since(lastClaim) >= w.Options.ClaimIdle {
+			lastClaim = time.Now()
+			messages, err = w.claim()
+		}
+		if err == nil && len(messages) == 0 {
+			messages, err = w.Cache.XReadGroup(w.Options.Stream, w.Options.Group, w.Options.Consumer, id, w.Options.Count, w.Options.Block)
+			if err == nil && id != ">" {
+				//pending消息按ID向后读取，处理失败的消息不会被重复读取，读完后开始读取新消息
+				if len(messages) == 0 {
+					id = ">"
+				} else {
+					id = messages[len(messages)-1].ID
+				}
+			}
+		}
+		if err != nil {
+			logger.Warn("StreamWorker read", slog.String("stream", w.Options.Stream), slog.String("group", w.Options.Group), slog.Duration("retry_after", backoff), slog.Any("error", err))
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > 5*time.Second {
+				backoff = 5 * time.Second
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+
+		for _, msg := range messages {
+			select {
+			case jobs <- msg:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// claim 认领超过ClaimIdle未确认的消息，投递次数超过MaxDeliveries的消息直接确认丢弃
+func (w *StreamWorker) claim() ([]StreamMessage, error) {
+	pendings, err := w.Cache.XPending(w.Options.Stream, w.Options.Group, w.Options.ClaimIdle, w.Options.Count)
+	if err != nil || len(pendings) == 0 {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pendings))
+	ids := make([]string, 0, len(pendings))
+	for _, p := range pendings {
+		deliveries[p.ID] = p.Deliveries + 1
+		ids = append(ids, p.ID)
+	}
+	messages, err := w.Cache.XClaim(w.Options.Stream, w.Options.Group, w.Options.Consumer, w.Options.ClaimIdle, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := messages[:0]
+	for _, msg := range messages {
+		msg.Deliveries = deliveries[msg.ID]
+		if w.Options.MaxDeliveries > 0 && msg.Deliveries > w.Options.MaxDeliveries {
+			loggerOr(w.Logger).Error("StreamWorker drop message exceeding max deliveries", slog.String("stream", w.Options.Stream), slog.String("group", w.Options.Group), slog.String("id", msg.ID), slog.Int64("deliveries", msg.Deliveries))
+			w.Cache.XAck(w.Options.Stream, w.Options.Group, msg.ID)
+			continue
+		}
+		claimed = append(claimed, msg)
+	}
+	return claimed, nil
+}
+
+// handle 调用Handler处理一条消息，成功后确认，panic视为处理失败
+func (w *StreamWorker) handle(msg StreamMessage) {
+	logger := loggerOr(w.Logger)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(logger, r)
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return w.Handler(w.ctx, &msg)
+	}()
+	if err != nil {
+		logger.Warn("StreamWorker handle message", slog.String("stream", w.Options.Stream), slog.String("group", w.Options.Group), slog.String("id", msg.ID), slog.Any("error", err))
+		return
+	}
+	if err := w.Cache.XAck(w.Options.Stream, w.Options.Group, msg.ID); err != nil {
+		logger.Warn("StreamWorker ack message", slog.String("stream", w.Options.Stream), slog.String("group", w.Options.Group), slog.String("id", msg.ID), slog.Any("error", err))
+	}
+}
+
+// StartStreamWorker 使用redis缓存后端启动消费组工人，ShutdownCoordinator关闭时在等待在途任务前停止
+func (L *Letsgo) StartStreamWorker(opts StreamWorkerOptions, handler StreamHandler) (*StreamWorker, error) {
+	cache := L.redisCache()
+	if cache == nil || cache.UseRedisOrMemcached != 2 {
+		return nil, fmt.Errorf("[error]StreamWorker needs a redis cache")
+	}
+	w := cache.NewStreamWorker(opts, handler)
+	if err := w.Start(); err != nil {
+		return nil, err
+	}
+	L.addWorker(w)
+	return w, nil
+}
+
+// worker 由Letsgo管理、关闭时需要停止的后台工人
+type worker interface {
+	Stop(ctx context.Context) error
+}
+
+// workerLifecycle StreamWorker与DelayWorker共用的启动与停止流程
+type workerLifecycle struct {
+	ctx       context.Context //传给Handler，Stop超时时取消
+	cancel    context.CancelFunc
+	stop      chan struct{} //关闭后停止取新任务
+	done      chan struct{} //run返回后关闭
+	stopOnce  sync.Once
+	startLock sync.Mutex
+}
+
+// started 是否已调用过start
+func (l *workerLifecycle) started() bool {
+	l.startLock.Lock()
+	defer l.startLock.Unlock()
+	return l.stop != nil
+}
+
+// start 在新协程中执行run，已启动时返回false
+func (l *workerLifecycle) start(run func()) bool {
+	l.startLock.Lock()
+	defer l.startLock.Unlock()
+	if l.stop != nil {
+		return false
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		run()
+	}()
+	return true
+}
+
+// shutdown 关闭stop并等待run返回，ctx到期时取消Handler的ctx并返回ctx的错误，未启动时直接返回
+func (l *workerLifecycle) shutdown(ctx context.Context) error {
+	if !l.started() {
+		return nil
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+	select {
+	case <-l.done:
+		l.cancel()
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// addWorker 登记工人，关闭时停止
+func (L *Letsgo) addWorker(w worker) {
+	L.workerLock.Lock()
+	defer L.workerLock.Unlock()
+	L.workers = append(L.workers, w)
+}
+
+// stopWorkers 并行停止全部登记的工人，返回第一个错误
+func (L *Letsgo) stopWorkers(ctx context.Context) error {
+	L.workerLock.Lock()
+	workers := L.workers
+	L.workers = nil
+	L.workerLock.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(workers))
+	for k, w := range workers {
+		wg.Add(1)
+		go func(k int, w worker) {
+			defer wg.Done()
+			errs[k] = w.Stop(ctx)
+		}(k, w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
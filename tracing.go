@@ -0,0 +1,223 @@
+package letsgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 链路追踪结构体，每个Letsgo实例拥有独立的TracerProvider
+type Tracing struct {
+	Provider   *sdktrace.TracerProvider
+	Tracer     trace.Tracer
+	Propagator propagation.TextMapPropagator //W3C traceparent
+}
+
+// InitTracing 初始化链路追踪，exporter可以使用NewOTLPExporter或NewJSONFileExporter
+func (L *Letsgo) InitTracing(ServiceName string, exporter sdktrace.SpanExporter) {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	L.Tracing = &Tracing{
+		Provider:   provider,
+		Tracer:     provider.Tracer("github.com/time2k/letsgo-ng"),
+		Propagator: propagation.TraceContext{},
+	}
+	L.markInit(resourceTracing)
+	L.wireSubsystems()
+}
+
+// NewOTLPExporter 返回一个OTLP/HTTP导出器，endpoint形如collector:4318
+func NewOTLPExporter(endpoint string, insecure bool) (sdktrace.SpanExporter, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Tracing create otlp exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// JSONFileExporter 将span以每行一个JSON的形式写入本地文件，便于测试与排查
+type JSONFileExporter struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+// JSONSpan JSONFileExporter输出的span结构
+type JSONSpan struct {
+	Name         string            `json:"name"`
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Status       string            `json:"status"`
+	StatusMsg    string            `json:"status_message,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// NewJSONFileExporter 返回一个写入path的JSONFileExporter
+func NewJSONFileExporter(path string) (*JSONFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("[error]Tracing open json exporter file: %w", err)
+	}
+	return &JSONFileExporter{file: file}, nil
+}
+
+// ExportSpans 实现sdktrace.SpanExporter
+func (e *JSONFileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	enc := json.NewEncoder(e.file)
+	for _, span := range spans {
+		js := JSONSpan{
+			Name:      span.Name(),
+			TraceID:   span.SpanContext().TraceID().String(),
+			SpanID:    span.SpanContext().SpanID().String(),
+			Kind:      span.SpanKind().String(),
+			Start:     span.StartTime(),
+			End:       span.EndTime(),
+			Status:    span.Status().Code.String(),
+			StatusMsg: span.Status().Description,
+		}
+		if span.Parent().IsValid() {
+			js.ParentSpanID = span.Parent().SpanID().String()
+		}
+		if attrs := span.Attributes(); len(attrs) > 0 {
+			js.Attributes = make(map[string]string, len(attrs))
+			for _, attr := range attrs {
+				js.Attributes[string(attr.Key)] = attr.Value.Emit()
+			}
+		}
+		if err := enc.Encode(js); err != nil {
+			return fmt.Errorf("[error]Tracing json exporter write: %w", err)
+		}
+	}
+	return nil
+}
+
+// Shutdown 实现sdktrace.SpanExporter
+func (e *JSONFileExporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.file.Close()
+}
+
+// tracer 返回Tracing的tracer，未初始化时返回nil
+func (t *Tracing) tracer() trace.Tracer {
+	if t == nil {
+		return nil
+	}
+	return t.Tracer
+}
+
+// startSpan 在ctx已经处于某个链路中时创建子span，否则返回不记录的空span，避免产生大量孤立的根span
+func startSpan(tracer trace.Tracer, ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tracer == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return tracer.Start(ctx, name, opts...)
+}
+
+// endSpan 根据err设置span状态并结束span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// echo.Context中保存请求级信息的key，由TraceMiddleware设置，GenCommparams读取
+const (
+	contextKeyRequestID = "letsgo.request_id"
+	contextKeyLogger    = "letsgo.logger"
+)
+
+// TraceMiddleware 设置请求id并提取W3C traceparent，已初始化链路追踪时为请求创建服务端span
+// 请求id与日志保存在echo.Context中，ctx写回请求，GenCommparams据此填充CommonParams，包级Handler注册的handler同样被追踪
+// L.Serve及L.GET等使用的echo已安装，自行创建的echo需通过e.Use安装
+func (L *Letsgo) TraceMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			//请求id，优先使用上游传入的X-Request-ID
+			requestid := req.Header.Get(echo.HeaderXRequestID)
+			if requestid == "" {
+				requestid = c.Response().Header().Get(echo.HeaderXRequestID)
+			}
+			if requestid == "" {
+				requestid = genRequestID()
+			}
+			c.Set(contextKeyRequestID, requestid)
+			c.Set(contextKeyLogger, L.Log)
+
+			ctx := propagation.TraceContext{}.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			if L.Tracing == nil {
+				c.SetRequest(req.WithContext(ctx))
+				return next(c)
+			}
+
+			ctx, span := L.Tracing.Tracer.Start(ctx, req.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("url.path", req.URL.Path),
+					attribute.String("client.address", c.RealIP()),
+					attribute.String("letsgo.pcode", c.QueryParam("pcode")),
+					attribute.String("letsgo.request_id", requestid),
+				),
+			)
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			status := c.Response().Status
+			var he *echo.HTTPError
+			if err != nil && errors.As(err, &he) {
+				status = he.Code
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			endSpan(span, err)
+			return err
+		}
+	}
+}
+
+// requestParams 将TraceMiddleware保存的请求id、ctx与日志放入CommonParams，未安装中间件时不做处理
+func requestParams(c echo.Context, commp *CommonParams) {
+	requestid, ok := c.Get(contextKeyRequestID).(string)
+	if !ok {
+		return
+	}
+	commp.SetParam("request_id", requestid)
+	commp.Ctx = c.Request().Context()
+	if logger, ok := c.Get(contextKeyLogger).(*slog.Logger); ok {
+		commp.logger = logger
+	}
+}